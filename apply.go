@@ -0,0 +1,230 @@
+package uci
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrApplyRolledBack is returned by ApplySession.Confirm, if the changes
+// have already been rolled back.
+var ErrApplyRolledBack = errors.New("apply: changes have been rolled back")
+
+// A Clock schedules function calls. It exists to replace the wall clock
+// in tests.
+type Clock interface {
+	// AfterFunc calls f in its own goroutine after d has elapsed. The
+	// returned Timer can be used to cancel the call.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// A Timer represents a single event scheduled by a Clock.
+type Timer interface {
+	// Stop prevents the timer from firing. It returns false, if the
+	// timer has already fired or been stopped.
+	Stop() bool
+}
+
+type wallClock struct{}
+
+func (wallClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+type applyState int
+
+const (
+	applyPending applyState = iota
+	applyConfirmed
+	applyRolledBack
+)
+
+// An Applier commits changes with automatic rollback. Trees created by
+// NewTree implement it, and so do their wrappers (see ReadOnly and Fork),
+// if the wrapped tree does.
+type Applier interface {
+	// Apply commits all changes like Commit does (including hooks), but
+	// rolls them back unless ApplySession.Confirm is called within the
+	// given timeout. This mirrors LuCI's "apply with rollback" and guards
+	// against changes which lock the user out.
+	//
+	// On rollback, the previous file contents are restored and reloaded
+	// (discarding pending changes to these configs), and the post-commit
+	// hooks are called again. If clock is nil, the wall clock is used.
+	Apply(timeout time.Duration, clock Clock) (*ApplySession, error)
+}
+
+var _ Applier = (*tree)(nil)
+
+// ApplySession represents changes committed by Applier.Apply, which are
+// rolled back unless confirmed in time.
+type ApplySession struct {
+	t        *tree
+	snapshot map[string][]byte // file content before commit, nil if missing
+	hooks    []CommitHook      // post-commit hooks, called after rollback
+	timer    Timer
+	done     chan struct{}
+
+	mu    sync.Mutex
+	state applyState
+	err   error
+}
+
+func (t *tree) Apply(timeout time.Duration, clock Clock) (*ApplySession, error) {
+	if clock == nil {
+		clock = wallClock{}
+	}
+
+	names, pre, post, err := t.taintedConfigs()
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := t.snapshotFiles(names)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &ApplySession{
+		t:        t,
+		snapshot: snapshot,
+		hooks:    post,
+		done:     make(chan struct{}),
+	}
+
+	if committed, err := t.commitWithHooks(names, "", pre, post); err != nil {
+		// only roll back, if anything was actually written
+		if len(committed) > 0 {
+			if rerr := s.Rollback(); rerr != nil {
+				err = errors.Join(err, rerr)
+			}
+		}
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.timer = clock.AfterFunc(timeout, func() { _ = s.Rollback() })
+	s.mu.Unlock()
+	return s, nil
+}
+
+// snapshotFiles reads the current content of the named config files.
+func (t *tree) snapshotFiles(names []string) (map[string][]byte, error) {
+	snapshot := make(map[string][]byte, len(names))
+	for _, name := range names {
+		body, err := t.readFile(name)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("apply: snapshot failed: %w", err)
+		}
+		snapshot[name] = body
+	}
+	return snapshot, nil
+}
+
+// restoreFiles writes back a snapshot taken by snapshotFiles, and replaces
+// the in-memory configs with the restored versions. It returns the names
+// of the restored configs.
+func (t *tree) restoreFiles(snapshot map[string][]byte) ([]string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var errs []error
+	names := make([]string, 0, len(snapshot))
+	for name, body := range snapshot {
+		if body == nil {
+			err := os.Remove(resolveSymlink(filepath.Join(t.dir, name)))
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, fmt.Errorf("rollback: %w", err))
+				continue
+			}
+			delete(t.configs, name)
+			names = append(names, name)
+			continue
+		}
+
+		if err := t.writeFile(name, bytes.NewReader(body)); err != nil {
+			errs = append(errs, fmt.Errorf("rollback: %w", err))
+			continue
+		}
+		if err := t.loadConfig(name); err != nil {
+			errs = append(errs, fmt.Errorf("rollback: %w", err))
+		}
+		names = append(names, name)
+	}
+	return names, errors.Join(errs...)
+}
+
+// Confirm keeps the applied changes and stops the rollback timer. It
+// returns ErrApplyRolledBack, if it was called too late.
+func (s *ApplySession) Confirm() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch s.state {
+	case applyRolledBack:
+		return ErrApplyRolledBack
+	case applyPending:
+		s.timer.Stop()
+		s.state = applyConfirmed
+		close(s.done)
+	case applyConfirmed:
+	}
+	return nil
+}
+
+// Rollback restores the config files to the state before Applier.Apply was
+// called, reloads them into the tree (discarding pending changes to
+// these configs), and calls the post-commit hooks again, so that services
+// pick up the restored configuration. This happens automatically when
+// the timeout expires, but may also be triggered earlier.
+//
+// Rolling back a confirmed session is a no-op. If a rollback is already
+// in progress (e.g. triggered by the timeout), Rollback waits for it to
+// finish, and returns its result. Hence it must not be called by the
+// post-commit hooks.
+func (s *ApplySession) Rollback() error {
+	s.mu.Lock()
+	if s.state != applyPending {
+		s.mu.Unlock()
+		<-s.done
+		return s.Err()
+	}
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.state = applyRolledBack
+	s.mu.Unlock()
+
+	// The hooks may call methods of the session, hence s.mu must not be
+	// held while restoring.
+	names, err := s.t.restoreFiles(s.snapshot)
+	if len(names) > 0 {
+		sort.Strings(names)
+		if herr := runHooks(s.hooks, names); herr != nil {
+			err = errors.Join(err, fmt.Errorf("post-commit hook: %w", herr))
+		}
+	}
+
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+	close(s.done)
+	return err
+}
+
+// Done returns a channel, which is closed once the session has been
+// confirmed or rolled back.
+func (s *ApplySession) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns the error encountered during rollback, if any.
+func (s *ApplySession) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
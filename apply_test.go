@@ -0,0 +1,242 @@
+package uci
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock records scheduled functions, which tests fire manually.
+type fakeClock struct {
+	mu     sync.Mutex
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	d       time.Duration
+	f       func()
+	stopped bool
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	tm := &fakeTimer{d: d, f: f}
+	c.timers = append(c.timers, tm)
+	return tm
+}
+
+func (tm *fakeTimer) Stop() bool {
+	was := tm.stopped
+	tm.stopped = true
+	return !was
+}
+
+// fire runs all timers, which have not been stopped.
+func (c *fakeClock) fire() {
+	c.mu.Lock()
+	timers := c.timers
+	c.timers = nil
+	c.mu.Unlock()
+
+	for _, tm := range timers {
+		if !tm.stopped {
+			tm.stopped = true
+			tm.f()
+		}
+	}
+}
+
+func TestApply_rollback(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "network", "\nconfig interface 'lan'\n\toption ipaddr '192.168.1.1'\n\n")
+
+	var reloads [][]string
+	r := NewTree(dir)
+	r.(HookRegistrar).AddPostCommitHook(func(configs []string) error {
+		reloads = append(reloads, configs)
+		return nil
+	})
+
+	require.NoError(t, r.SetType("network", "lan", "ipaddr", TypeOption, "10.0.0.1"))
+	require.NoError(t, r.AddSection("firewall", "wan", "zone"))
+
+	clock := &fakeClock{}
+	s, err := r.(Applier).Apply(30*time.Second, clock)
+	require.NoError(t, err)
+	assert.Len(clock.timers, 1)
+	assert.Equal(30*time.Second, clock.timers[0].d)
+
+	body, _ := os.ReadFile(filepath.Join(dir, "network"))
+	assert.Contains(string(body), "10.0.0.1")
+	assert.FileExists(filepath.Join(dir, "firewall"))
+	assert.Equal([][]string{{"firewall", "network"}}, reloads)
+
+	clock.fire()
+	<-s.Done()
+	assert.NoError(s.Err())
+	assert.ErrorIs(s.Confirm(), ErrApplyRolledBack)
+
+	body, _ = os.ReadFile(filepath.Join(dir, "network"))
+	assert.Equal("\nconfig interface 'lan'\n\toption ipaddr '192.168.1.1'\n\n", string(body))
+	assert.NoFileExists(filepath.Join(dir, "firewall"))
+	assert.Equal([][]string{{"firewall", "network"}, {"firewall", "network"}}, reloads)
+
+	value, _ := r.GetLast("network", "lan", "ipaddr")
+	assert.Equal("192.168.1.1", value)
+	assert.NotContains(r.(*tree).configs, "firewall")
+}
+
+func TestApply_confirm(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "network", "\nconfig interface 'lan'\n\toption ipaddr '192.168.1.1'\n\n")
+
+	r := NewTree(dir)
+	require.NoError(t, r.SetType("network", "lan", "ipaddr", TypeOption, "10.0.0.1"))
+
+	clock := &fakeClock{}
+	s, err := r.(Applier).Apply(time.Minute, clock)
+	require.NoError(t, err)
+
+	assert.NoError(s.Confirm())
+	assert.NoError(s.Confirm())
+	<-s.Done()
+	assert.True(clock.timers[0].stopped)
+
+	// too late
+	clock.fire()
+	assert.NoError(s.Rollback())
+
+	value, _ := r.GetLast("network", "lan", "ipaddr")
+	assert.Equal("10.0.0.1", value)
+	body, _ := os.ReadFile(filepath.Join(dir, "network"))
+	assert.Contains(string(body), "10.0.0.1")
+}
+
+func TestApply_wallClock(t *testing.T) {
+	r := NewTree(t.TempDir())
+	require.NoError(t, r.AddSection("system", "main", "system"))
+
+	s, err := r.(Applier).Apply(time.Millisecond, nil)
+	require.NoError(t, err)
+
+	select {
+	case <-s.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for rollback")
+	}
+	assert.ErrorIs(t, s.Confirm(), ErrApplyRolledBack)
+}
+
+func TestApply_hookUsesSession(t *testing.T) {
+	r := NewTree(t.TempDir())
+	require.NoError(t, r.AddSection("system", "main", "system"))
+
+	var s *ApplySession
+	var hookErr error
+	r.(HookRegistrar).AddPostCommitHook(func([]string) error {
+		if s != nil {
+			hookErr = s.Err()
+			assert.ErrorIs(t, s.Confirm(), ErrApplyRolledBack)
+		}
+		return nil
+	})
+
+	clock := &fakeClock{}
+	var err error
+	s, err = r.(Applier).Apply(time.Minute, clock)
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		clock.fire()
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("rollback blocked by hook")
+	}
+	<-s.Done()
+	assert.NoError(t, hookErr)
+	assert.NoError(t, s.Err())
+}
+
+func TestApply_concurrentRollback(t *testing.T) {
+	r := NewTree(t.TempDir())
+	require.NoError(t, r.AddSection("system", "main", "system"))
+
+	var rollingBack bool
+	entered, release := make(chan struct{}), make(chan struct{})
+	r.(HookRegistrar).AddPostCommitHook(func([]string) error {
+		if !rollingBack {
+			return nil
+		}
+		close(entered)
+		<-release
+		return errors.New("reload failed")
+	})
+
+	clock := &fakeClock{}
+	s, err := r.(Applier).Apply(time.Minute, clock)
+	require.NoError(t, err)
+
+	rollingBack = true
+	go clock.fire()
+	<-entered
+
+	result := make(chan error)
+	go func() { result <- s.Rollback() }()
+	select {
+	case err = <-result:
+		t.Fatalf("Rollback returned %v before the rollback finished", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	assert.ErrorContains(t, <-result, "reload failed")
+	assert.ErrorContains(t, s.Err(), "reload failed")
+}
+
+func TestApply_rollbackSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(t.TempDir(), "system")
+	require.NoError(t, os.Symlink(target, filepath.Join(dir, "system")))
+
+	r := NewTree(dir)
+	require.NoError(t, r.AddSection("system", "main", "system"))
+	clock := &fakeClock{}
+	s, err := r.(Applier).Apply(time.Minute, clock)
+	require.NoError(t, err)
+	assert.FileExists(t, target)
+
+	require.NoError(t, s.Rollback())
+	assert.NoFileExists(t, target)
+	link, err := os.Readlink(filepath.Join(dir, "system"))
+	require.NoError(t, err)
+	assert.Equal(t, target, link)
+}
+
+func TestApplier(t *testing.T) {
+	assert := assert.New(t)
+	r := NewTree(t.TempDir())
+
+	assert.Implements((*Applier)(nil), r)
+	assert.Implements((*Applier)(nil), ReadOnly(r))
+	assert.Implements((*Applier)(nil), r.(Cloner).Clone())
+
+	// forks of trees without apply support
+	f := &Fork{Tree: struct{ Tree }{r}}
+	var nsErr ErrNotSupported
+	_, err := f.Apply(time.Second, nil)
+	assert.ErrorAs(err, &nsErr)
+	assert.Equal("Apply", nsErr.Op)
+}
@@ -0,0 +1,257 @@
+package uci
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ArchivePrefix is the directory of config files within a backup archive,
+// as created by OpenWrt's sysupgrade.
+const ArchivePrefix = "etc/config/"
+
+// maxArchiveEntrySize limits the size of a single config file read from
+// an archive.
+const maxArchiveEntrySize = 16 << 20
+
+// An Archiver exports and imports configs as backup archives. Trees
+// created by NewTree or NewArchiveTree implement it, and so do their
+// wrappers (see ReadOnly and Fork), if the wrapped tree does.
+type Archiver interface {
+	// Backup writes the given configs (or all configs, if none are
+	// given) as a gzip-compressed tar archive to w, in the format
+	// created by OpenWrt's sysupgrade (i.e. the files are stored as
+	// etc/config/*). Configs with pending changes are included with
+	// these changes.
+	Backup(w io.Writer, configs ...string) error
+
+	// Restore reads a (gzip-compressed) tar archive as created by Backup
+	// or sysupgrade, and writes all config files contained therein. Each
+	// file is parsed first; if any file is invalid, nothing is written.
+	// Restored configs replace their in-memory versions (discarding
+	// pending changes), other configs are left untouched. Hooks and
+	// validators are not run.
+	Restore(r io.Reader) error
+}
+
+var _ Archiver = (*tree)(nil)
+
+func (t *tree) Backup(w io.Writer, configs ...string) error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if len(configs) == 0 {
+		var err error
+		if configs, err = t.listConfigs(); err != nil {
+			return err
+		}
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, name := range configs {
+		body, fi, err := t.backupFile(name)
+		if err != nil {
+			return err
+		}
+
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     ArchivePrefix + name,
+			Size:     int64(len(body)),
+			Mode:     int64(DefaultFileMode),
+			ModTime:  time.Now(),
+		}
+		if fi != nil {
+			hdr.Mode = int64(fi.Mode().Perm())
+			hdr.ModTime = fi.ModTime()
+		}
+		if err = tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("backup: %w", err)
+		}
+		if _, err = tw.Write(body); err != nil {
+			return fmt.Errorf("backup: %w", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("backup: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("backup: %w", err)
+	}
+	return nil
+}
+
+// listConfigs returns the sorted names of all config files in the tree's
+// directory, and of all configs held in memory. Its call must be guarded
+// by locking the tree's mutex (at least for reading).
+func (t *tree) listConfigs() ([]string, error) {
+	var names []string
+	if t.archive != nil {
+		for name := range t.archive {
+			names = append(names, name)
+		}
+	} else {
+		entries, err := os.ReadDir(t.dir)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("listing configs failed: %w", err)
+		}
+		for _, e := range entries {
+			if strings.HasPrefix(e.Name(), ".") || e.IsDir() {
+				continue
+			}
+			names = append(names, e.Name())
+		}
+	}
+	for name := range t.configs {
+		names = appendUnique(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// backupFile returns the content of a config for a backup. Configs with
+// pending changes are serialized from memory, all others are read
+// verbatim from disk (preserving comments). The file info (of the file
+// on disk, or of the archive entry) is nil for configs not present there. Its call must be guarded by locking the
+// tree's mutex (at least for reading).
+func (t *tree) backupFile(name string) ([]byte, os.FileInfo, error) {
+	body, err := t.readFile(name)
+	exists := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("backup: %w", err)
+	}
+
+	var fi os.FileInfo
+	if exists && t.archive == nil {
+		if fi, err = os.Stat(filepath.Join(t.dir, name)); err != nil {
+			return nil, nil, fmt.Errorf("backup: %w", err)
+		}
+	} else if exists {
+		fi = t.archiveInfo[name]
+	}
+
+	if cfg, ok := t.configs[name]; ok {
+		cfg.mu.RLock()
+		defer cfg.mu.RUnlock()
+
+		if cfg.tainted || !exists {
+			var buf bytes.Buffer
+			if _, err = cfg.WriteTo(&buf); err != nil {
+				return nil, nil, fmt.Errorf("backup: %w", err)
+			}
+			return buf.Bytes(), fi, nil
+		}
+	}
+
+	if !exists {
+		return nil, nil, fmt.Errorf("backup: %w", err)
+	}
+	return body, fi, nil
+}
+
+func (t *tree) Restore(r io.Reader) error {
+	files, _, err := readArchive(r)
+	if err != nil {
+		return err
+	}
+
+	// parse everything first, so that we don't restore partially
+	names := make([]string, 0, len(files))
+	configs := make(map[string]*config, len(files))
+	var errs []error
+	for name, body := range files {
+		cfg, err := parse(name, string(body))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("restore: %s: %w", name, err))
+			continue
+		}
+		names = append(names, name)
+		configs[name] = cfg
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	sort.Strings(names)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, name := range names {
+		if err = t.writeFile(name, bytes.NewReader(files[name])); err != nil {
+			return fmt.Errorf("restore: %w", err)
+		}
+		t.setConfig(configs[name])
+	}
+	return nil
+}
+
+// readArchive extracts the config files from a (possibly gzip-compressed)
+// tar archive, along with their file infos (mode and modification time
+// of the entries). Only regular files directly within ArchivePrefix are
+// considered; other entries are skipped.
+func readArchive(r io.Reader) (map[string][]byte, map[string]os.FileInfo, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, nil, fmt.Errorf("archive: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = br
+	}
+
+	files := make(map[string][]byte)
+	infos := make(map[string]os.FileInfo)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return files, infos, nil
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("archive: %w", err)
+		}
+
+		name, ok := archiveConfigName(hdr)
+		if !ok {
+			continue
+		}
+		body, err := io.ReadAll(io.LimitReader(tr, maxArchiveEntrySize+1))
+		if err != nil {
+			return nil, nil, fmt.Errorf("archive: %s: %w", hdr.Name, err)
+		}
+		if len(body) > maxArchiveEntrySize {
+			return nil, nil, fmt.Errorf("archive: %s: file too large", hdr.Name)
+		}
+		files[name] = body
+		infos[name] = hdr.FileInfo()
+	}
+}
+
+// archiveConfigName extracts the config name from an archive entry.
+func archiveConfigName(hdr *tar.Header) (string, bool) {
+	if hdr.Typeflag != tar.TypeReg {
+		return "", false
+	}
+	name := strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+	if !strings.HasPrefix(name, ArchivePrefix) {
+		return "", false
+	}
+	name = strings.TrimPrefix(name, ArchivePrefix)
+	if name == "" || strings.Contains(name, "/") || strings.HasPrefix(name, ".") {
+		return "", false
+	}
+	return name, true
+}
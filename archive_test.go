@@ -0,0 +1,135 @@
+package uci
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makeArchive creates an uncompressed tar archive with the given files.
+func makeArchive(t *testing.T, files ...string) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for i := 0; i < len(files); i += 2 {
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     files[i],
+			Size:     int64(len(files[i+1])),
+			Mode:     0o644,
+		}))
+		_, err := tw.Write([]byte(files[i+1]))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return &buf
+}
+
+func TestBackup(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	const system = "# comments are preserved\nconfig system\n\toption hostname 'OpenWrt'\n"
+	writeTestConfig(t, dir, "system", system)
+	writeTestConfig(t, dir, "network", "config interface 'lan'\n")
+	writeTestConfig(t, dir, ".hidden", "config foo\n")
+	require.NoError(t, os.Chmod(filepath.Join(dir, "network"), 0o600))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "subdir"), 0o755))
+
+	r := NewTree(dir)
+	require.NoError(t, r.SetType("network", "lan", "proto", TypeOption, "dhcp"))
+	require.NoError(t, r.AddSection("firewall", "wan", "zone"))
+
+	var buf bytes.Buffer
+	require.NoError(t, r.(Archiver).Backup(&buf))
+
+	files, _, err := readArchive(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(map[string][]byte{
+		"firewall": []byte("\nconfig zone 'wan'\n\n"),
+		"network":  []byte("\nconfig interface 'lan'\n\toption proto 'dhcp'\n\n"),
+		"system":   []byte(system),
+	}, files)
+
+	buf.Reset()
+	require.NoError(t, r.(Archiver).Backup(&buf, "system"))
+	files, _, err = readArchive(&buf)
+	require.NoError(t, err)
+	assert.Len(files, 1)
+
+	assert.Error(r.(Archiver).Backup(&buf, "nonexistent"))
+}
+
+func TestRestore(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "network", "config interface 'lan'\n")
+	writeTestConfig(t, dir, "system", "config system\n")
+
+	r := NewTree(dir)
+	require.NoError(t, r.SetType("network", "lan", "proto", TypeOption, "dhcp"))
+	require.NoError(t, r.LoadConfig("system", false))
+
+	archive := makeArchive(t,
+		"./etc/config/network", "config interface 'lan'\n\toption proto 'static'\n",
+		"etc/config/firewall", "config zone 'wan'\n",
+		"etc/config/../../../evil", "config foo\n",
+		"etc/dropbear/authorized_keys", "ssh-ed25519 AAAA",
+	)
+	require.NoError(t, r.(Archiver).Restore(archive))
+
+	value, _ := r.GetLast("network", "lan", "proto")
+	assert.Equal("static", value)
+	assert.False(r.(*tree).configs["network"].tainted)
+	assert.FileExists(filepath.Join(dir, "firewall"))
+	assert.NoFileExists(filepath.Join(dir, "evil"))
+	assert.NoFileExists(filepath.Join(dir, "authorized_keys"))
+	assert.FileExists(filepath.Join(dir, "system")) // untouched
+
+	// round trip via Backup
+	var buf bytes.Buffer
+	require.NoError(t, r.(Archiver).Backup(&buf, "network"))
+	other := NewTree(t.TempDir())
+	require.NoError(t, other.(Archiver).Restore(&buf))
+	value, _ = other.GetLast("network", "lan", "proto")
+	assert.Equal("static", value)
+}
+
+func TestRestore_invalid(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	r := NewTree(dir)
+
+	err := r.(Archiver).Restore(makeArchive(t,
+		"etc/config/network", "config interface 'lan'\n",
+		"etc/config/broken", "config 'foo\n",
+	))
+	assert.ErrorContains(err, "restore: broken: parse")
+	assert.NoFileExists(filepath.Join(dir, "network"))
+
+	assert.Error(r.(Archiver).Restore(bytes.NewReader([]byte{0x1f, 0x8b, 0})))
+	assert.Error(r.(Archiver).Restore(bytes.NewReader([]byte("not an archive"))))
+}
+
+func TestArchiver(t *testing.T) {
+	assert := assert.New(t)
+	r := NewTree(t.TempDir())
+
+	assert.Implements((*Archiver)(nil), r)
+	assert.Implements((*Archiver)(nil), ReadOnly(r))
+	assert.Implements((*Archiver)(nil), r.(Cloner).Clone())
+
+	// forks of trees without archive support
+	f := &Fork{Tree: struct{ Tree }{r}}
+	var nsErr ErrNotSupported
+	assert.ErrorAs(f.Backup(&bytes.Buffer{}), &nsErr)
+	assert.Equal("Backup", nsErr.Op)
+	assert.ErrorAs(ReadOnly(struct{ Tree }{r}).(Archiver).Backup(&bytes.Buffer{}), &nsErr)
+	assert.ErrorAs(f.Restore(&bytes.Buffer{}), &nsErr)
+	assert.Equal("Restore", nsErr.Op)
+}
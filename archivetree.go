@@ -0,0 +1,68 @@
+package uci
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrArchiveTree is returned by trees created with NewArchiveTree for
+// operations which would need to write files.
+var ErrArchiveTree = errors.New("archive trees cannot be committed, use Backup to export changes")
+
+// archiveTree serves configs from the content of a backup archive.
+type archiveTree struct {
+	*tree
+}
+
+// NewArchiveTree creates a tree from a (possibly gzip-compressed) tar
+// archive, as created by Archiver.Backup or OpenWrt's sysupgrade, without
+// extracting it. Only the etc/config/ entries are considered.
+//
+// The tree can be read and modified like any other tree, but changes
+// are only staged in memory: Commit (and all other operations writing
+// files) returns ErrArchiveTree. Use Archiver.Backup to export the tree
+// including its pending changes into a new archive, and DryRunner.DryRun
+// to inspect the changes relative to the original archive.
+func NewArchiveTree(r io.Reader) (Tree, error) {
+	files, infos, err := readArchive(r)
+	if err != nil {
+		return nil, err
+	}
+	return &archiveTree{&tree{
+		configs:     make(map[string]*config),
+		archive:     files,
+		archiveInfo: infos,
+	}}, nil
+}
+
+func (*archiveTree) Commit(...string) error {
+	return ErrArchiveTree
+}
+
+func (*archiveTree) CommitWithMessage(string, ...string) error {
+	return ErrArchiveTree
+}
+
+func (*archiveTree) Apply(time.Duration, Clock) (*ApplySession, error) {
+	return nil, ErrArchiveTree
+}
+
+func (*archiveTree) Restore(io.Reader) error {
+	return ErrArchiveTree
+}
+
+func (a *archiveTree) Batch(r io.Reader) error {
+	return a.execBatch(r, a.Commit)
+}
+
+func (a *archiveTree) Clone() *Fork {
+	f := a.tree.Clone()
+	f.Tree = &archiveTree{f.fork}
+	return f
+}
+
+func (*archiveTree) Watch(context.Context) (<-chan WatchEvent, error) {
+	return nil, ErrWatchNotSupported
+}
@@ -0,0 +1,116 @@
+package uci
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveTree(t *testing.T) {
+	assert := assert.New(t)
+
+	// create a compressed archive via Backup
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "network", "# lan\nconfig interface 'lan'\n\toption proto 'static'\n")
+	writeTestConfig(t, dir, "system", "config system\n\toption hostname 'customer'\n")
+	var archive bytes.Buffer
+	require.NoError(t, NewTree(dir).(Archiver).Backup(&archive))
+
+	r, err := NewArchiveTree(&archive)
+	require.NoError(t, err)
+
+	value, ok := r.GetLast("system", "@system[0]", "hostname")
+	assert.True(ok)
+	assert.Equal("customer", value)
+
+	names, err := r.GetSections("network", "interface")
+	require.NoError(t, err)
+	assert.Equal([]string{"lan"}, names)
+
+	_, err = r.GetSections("wireless", "wifi-device")
+	assert.Error(err)
+
+	// stage changes
+	require.NoError(t, r.SetType("network", "lan", "proto", TypeOption, "dhcp"))
+	require.NoError(t, r.AddSection("firewall", "wan", "zone"))
+
+	assert.ErrorIs(r.Commit(), ErrArchiveTree)
+	assert.ErrorIs(r.(HistoryKeeper).CommitWithMessage("msg"), ErrArchiveTree)
+	_, err = r.(Applier).Apply(time.Second, nil)
+	assert.ErrorIs(err, ErrArchiveTree)
+	assert.ErrorIs(r.(Archiver).Restore(&archive), ErrArchiveTree)
+	assert.ErrorIs(r.(Cloner).Clone().Commit(), ErrArchiveTree)
+	assert.ErrorIs(r.(Batcher).Batch(strings.NewReader("commit\n")), ErrArchiveTree)
+	_, err = r.(Watcher).Watch(context.Background())
+	assert.ErrorIs(err, ErrWatchNotSupported)
+
+	diffs, err := r.(DryRunner).DryRun("network")
+	require.NoError(t, err)
+	require.Len(t, diffs, 1)
+	assert.Equal("etc/config/network", diffs[0].Path)
+	assert.Contains(diffs[0].Diff, "+\toption proto 'dhcp'")
+
+	// revert against the archive content
+	require.NoError(t, r.SetType("system", "@system[0]", "hostname", TypeOption, "changed"))
+	require.NoError(t, r.RevertOption("system", "@system[0]", "hostname"))
+	value, _ = r.GetLast("system", "@system[0]", "hostname")
+	assert.Equal("customer", value)
+
+	// export with staged changes
+	var out bytes.Buffer
+	require.NoError(t, r.(Archiver).Backup(&out))
+	files, _, err := readArchive(&out)
+	require.NoError(t, err)
+	assert.Equal(map[string][]byte{
+		"firewall": []byte("\nconfig zone 'wan'\n\n"),
+		"network":  []byte("\nconfig interface 'lan'\n\toption proto 'dhcp'\n\n"),
+		"system":   []byte("config system\n\toption hostname 'customer'\n"),
+	}, files)
+}
+
+func TestArchiveTree_invalid(t *testing.T) {
+	_, err := NewArchiveTree(bytes.NewReader([]byte{0x1f, 0x8b, 0}))
+	assert.Error(t, err)
+}
+
+func TestArchiveTree_fileInfo(t *testing.T) {
+	assert := assert.New(t)
+
+	modTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	var in bytes.Buffer
+	tw := tar.NewWriter(&in)
+	for _, hdr := range []*tar.Header{
+		{Name: "etc/config/wireless", Mode: 0o600, ModTime: modTime},
+		{Name: "etc/config/system", Mode: 0o644, ModTime: modTime},
+	} {
+		const body = "config foo 'bar'\n"
+		hdr.Typeflag = tar.TypeReg
+		hdr.Size = int64(len(body))
+		require.NoError(t, tw.WriteHeader(hdr))
+		_, err := tw.Write([]byte(body))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+
+	r, err := NewArchiveTree(&in)
+	require.NoError(t, err)
+	require.NoError(t, r.SetType("system", "bar", "baz", TypeOption, "1"))
+
+	// both unchanged and modified files keep mode and modification time
+	var out bytes.Buffer
+	require.NoError(t, r.(Archiver).Backup(&out))
+	_, infos, err := readArchive(&out)
+	require.NoError(t, err)
+	require.Len(t, infos, 2)
+	assert.Equal(os.FileMode(0o600), infos["wireless"].Mode().Perm())
+	assert.Equal(os.FileMode(0o644), infos["system"].Mode().Perm())
+	assert.True(modTime.Equal(infos["wireless"].ModTime()))
+	assert.True(modTime.Equal(infos["system"].ModTime()))
+}
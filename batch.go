@@ -0,0 +1,541 @@
+package uci
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// BatchError is returned by Batcher.Batch, if a command of the script
+// could not be parsed or executed.
+type BatchError struct {
+	Line    int    // line number, starting at 1
+	Command string // the offending line
+	Err     error
+}
+
+func (err *BatchError) Error() string {
+	return fmt.Sprintf("batch: line %d: %v", err.Line, err.Err)
+}
+
+func (err *BatchError) Unwrap() error {
+	return err.Err
+}
+
+var (
+	errBatchUnknownCommand = errors.New("unknown command")
+	errBatchArguments      = errors.New("invalid arguments")
+	errBatchUnterminated   = errors.New("unterminated quote")
+	errBatchExists         = errors.New("entry already exists")
+	errBatchNewline        = errors.New("newlines cannot be represented in a batch script")
+)
+
+// BatchOptions controls EncodeBatch.
+type BatchOptions struct {
+	DiffOptions
+
+	// Commit appends a commit command for each changed config.
+	Commit bool
+}
+
+// EncodeBatch writes a script for "uci batch" to w, which turns the given
+// configs (or all configs in either snapshot, if none are given) from
+// their version in a into their version in b. A config missing in a
+// snapshot is treated as empty. Sections are matched as described for
+// DiffConfig.
+//
+// The script consists of set, add, add_list, del_list, delete, rename
+// and reorder commands (and optionally commit), and can be executed with
+// Batcher.Batch as well. A named section missing in b is considered
+// renamed (instead of deleted), if a new named section in b has the same
+// type and options.
+//
+// Since a command must fit on a single line, an error is returned (and
+// nothing is written), if a section type or value contains a newline.
+func EncodeBatch(w io.Writer, a, b *TreeSnapshot, opts BatchOptions, configs ...string) error {
+	if len(configs) == 0 {
+		configs = appendUnique(a.Configs(), b.Configs()...)
+		sort.Strings(configs)
+	}
+
+	var script []string
+	for _, name := range configs {
+		old, ok := a.configs[name]
+		if !ok {
+			old = newConfig(name)
+		}
+		cur, ok := b.configs[name]
+		if !ok {
+			cur = newConfig(name)
+		}
+
+		cmds := encodeConfig(old, cur, opts.DiffOptions)
+		for _, cmd := range cmds {
+			if strings.ContainsAny(cmd, "\r\n") {
+				return fmt.Errorf("batch: %s: %w: %q", name, errBatchNewline, cmd)
+			}
+		}
+		if len(cmds) > 0 && opts.Commit {
+			cmds = append(cmds, "commit "+name)
+		}
+		script = append(script, cmds...)
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, cmd := range script {
+		bw.WriteString(cmd)
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// A Batcher exchanges changes as scripts for "uci batch". Trees created
+// by NewTree or NewArchiveTree implement it, and so do their wrappers (see
+// ReadOnly and Fork), if the wrapped tree does.
+type Batcher interface {
+	// ExportBatch writes the pending changes of the given configs (or of
+	// all configs, if none are given) as a script for "uci batch" to w.
+	// See EncodeBatch for details. The script contains no commit command.
+	ExportBatch(w io.Writer, configs ...string) error
+
+	// Batch executes a script in the format of "uci batch". It supports
+	// the set, add, add_list, del_list, delete, rename, reorder and commit
+	// commands; empty lines and lines starting with "#" are ignored. All
+	// commands except commit are applied at once (like Update does), and
+	// nothing is changed, if any of them fails (see BatchError). Commits
+	// are performed afterwards.
+	Batch(r io.Reader) error
+}
+
+var _ Batcher = (*tree)(nil)
+
+func (t *tree) ExportBatch(w io.Writer, configs ...string) error {
+	names, _, _, err := t.taintedConfigs(configs...)
+	if err != nil {
+		return err
+	}
+
+	base := &TreeSnapshot{configs: make(map[string]*config, len(names))}
+	for _, name := range names {
+		if base.configs[name], err = t.committedConfig(name); err != nil {
+			return err
+		}
+	}
+	cur, err := t.Snapshot(names...)
+	if err != nil {
+		return err
+	}
+	return EncodeBatch(w, base, cur, BatchOptions{}, names...)
+}
+
+// encodeConfig returns the batch commands turning old into cur. Section
+// references are computed on a working copy of old, to which each command
+// is applied as well, so that synthetic names stay valid.
+func encodeConfig(old, cur *config, opts DiffOptions) []string {
+	var cmds []string
+	emit := func(format string, args ...interface{}) {
+		cmds = append(cmds, fmt.Sprintf(format, args...))
+	}
+
+	match := matchSections(old, cur, opts)
+	matchRenamed(old, cur, match)
+	work := old.clone()
+	orig := append([]*section(nil), work.Sections...)
+	ref := func(sec *section) string {
+		return work.Name + "." + work.sectionName(sec)
+	}
+
+	// delete unmatched sections, starting with the last one to keep
+	// synthetic names intact
+	matched := make([]bool, len(orig))
+	for _, i := range match {
+		if i >= 0 {
+			matched[i] = true
+		}
+	}
+	for i := len(orig) - 1; i >= 0; i-- {
+		if !matched[i] {
+			emit("delete %s", ref(orig[i]))
+			work.remove(orig[i])
+		}
+	}
+
+	// retype matched sections, and add new ones
+	target := make([]*section, len(cur.Sections))
+	for j, sec := range cur.Sections {
+		if i := match[j]; i >= 0 {
+			target[j] = orig[i]
+			if orig[i].Name != sec.Name {
+				emit("rename %s=%s", ref(orig[i]), quoteBatch(sec.Name))
+				orig[i].Name = sec.Name
+			}
+			if orig[i].Type != sec.Type {
+				emit("set %s=%s", ref(orig[i]), quoteBatch(sec.Type))
+				orig[i].Type = sec.Type
+			}
+			continue
+		}
+
+		target[j] = newSection(sec.Type, sec.Name)
+		if sec.Name != "" {
+			emit("set %s.%s=%s", work.Name, sec.Name, quoteBatch(sec.Type))
+		} else {
+			emit("add %s %s", work.Name, sec.Type)
+		}
+		work.Add(target[j])
+	}
+
+	// reorder sections, moving as few sections as possible: each moved
+	// section is placed after its predecessor in cur
+	pos := make(map[*section]int, len(target))
+	for j, sec := range target {
+		pos[sec] = j
+	}
+	seq := make([]int, len(work.Sections))
+	for k, sec := range work.Sections {
+		seq[k] = pos[sec]
+	}
+	stay := make(map[*section]bool, len(seq))
+	for k, ok := range stableSections(seq) {
+		if ok {
+			stay[work.Sections[k]] = true
+		}
+	}
+	for j, sec := range target {
+		if stay[sec] {
+			continue
+		}
+		name := ref(sec)
+		work.remove(sec)
+		n := 0
+		if j > 0 {
+			n = indexOf(work.Sections, target[j-1]) + 1
+		}
+		work.insert(n, sec)
+		emit("reorder %s=%d", name, n)
+	}
+
+	// update options
+	for j, sec := range cur.Sections {
+		prev := target[j]
+		name := ref(prev)
+		for _, ch := range diffOptions(name, prev, sec, true) {
+			switch ch.Type { //nolint:exhaustive
+			case OptionRemoved:
+				emit("delete %s.%s", name, ch.Option)
+			case OptionSet:
+				if sec.Get(ch.Option).Type == TypeOption {
+					emit("set %s.%s=%s", name, ch.Option, quoteBatch(ch.Values[0]))
+					continue
+				}
+				if prev.Get(ch.Option) != nil {
+					emit("delete %s.%s", name, ch.Option)
+				}
+				for _, v := range ch.Values {
+					emit("add_list %s.%s=%s", name, ch.Option, quoteBatch(v))
+				}
+			case ListRemoved:
+				for _, v := range ch.Values {
+					emit("del_list %s.%s=%s", name, ch.Option, quoteBatch(v))
+				}
+			case ListAdded:
+				for _, v := range ch.Values {
+					emit("add_list %s.%s=%s", name, ch.Option, quoteBatch(v))
+				}
+			}
+		}
+	}
+	return cmds
+}
+
+// matchRenamed extends a result of matchSections: each unmatched named
+// section in cur is matched with an unmatched named section in old, which
+// has the same type and options, and whose name is not used in cur.
+func matchRenamed(old, cur *config, match []int) {
+	used := make([]bool, len(old.Sections))
+	for _, i := range match {
+		if i >= 0 {
+			used[i] = true
+		}
+	}
+	for j, sec := range cur.Sections {
+		if sec.Name == "" || match[j] >= 0 {
+			continue
+		}
+		for i, prev := range old.Sections {
+			if !used[i] && prev.Name != "" && cur.getNamed(prev.Name) == nil && equalSections(prev, sec) {
+				match[j] = i
+				used[i] = true
+				break
+			}
+		}
+	}
+}
+
+func indexOf(sections []*section, s *section) int {
+	for i, sec := range sections {
+		if sec == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// quoteBatch quotes a value for use in a batch script.
+func quoteBatch(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func (t *tree) Batch(r io.Reader) error {
+	return t.execBatch(r, t.Commit)
+}
+
+// execBatch executes a batch script. The commit commands are collected,
+// and executed by calling commit after all other commands have been
+// applied.
+func (t *tree) execBatch(r io.Reader, commit func(configs ...string) error) error {
+	var (
+		commits   []string
+		commitAll bool
+	)
+	err := t.update(func(x *tx) error {
+		scanner := bufio.NewScanner(r)
+		for n := 1; scanner.Scan(); n++ {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || line[0] == '#' {
+				continue
+			}
+
+			args, err := splitBatchLine(line)
+			if err == nil && args[0] == "commit" {
+				switch len(args) {
+				case 1:
+					commitAll = true
+				case 2:
+					commits = appendUnique(commits, args[1])
+				default:
+					err = errBatchArguments
+				}
+			} else if err == nil {
+				err = x.exec(args)
+			}
+			if err != nil {
+				return &BatchError{Line: n, Command: line, Err: err}
+			}
+		}
+		return scanner.Err()
+	})
+	if err != nil {
+		return err
+	}
+
+	if commitAll {
+		return commit()
+	}
+	if len(commits) > 0 {
+		return commit(commits...)
+	}
+	return nil
+}
+
+// splitBatchLine splits a line of a batch script into its arguments,
+// removing quotes like uci does: text within single quotes is taken
+// literally, while within double quotes and outside of quotes a
+// backslash escapes the next character.
+func splitBatchLine(line string) ([]string, error) {
+	var (
+		args  []string
+		arg   strings.Builder
+		inArg bool
+		quote rune
+	)
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case quote == '\'' && c == '\'',
+			quote == '"' && c == '"':
+			quote = 0
+		case quote == '\'':
+			arg.WriteRune(c)
+		case c == '\\' && i+1 < len(runes):
+			i++
+			arg.WriteRune(runes[i])
+			inArg = true
+		case quote == '"':
+			arg.WriteRune(c)
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(c)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, errBatchUnterminated
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// batchRef is a parsed "config.section.option=value" argument. Option
+// and value are optional.
+type batchRef struct {
+	config, section, option string
+	value                   string
+	hasValue                bool
+}
+
+func parseBatchRef(arg string) (ref batchRef, err error) {
+	key := arg
+	if i := strings.IndexByte(arg, '='); i >= 0 {
+		key, ref.value, ref.hasValue = arg[:i], arg[i+1:], true
+	}
+
+	parts := strings.SplitN(key, ".", 3)
+	ref.config = parts[0]
+	if len(parts) > 1 {
+		ref.section = parts[1]
+	}
+	if len(parts) > 2 {
+		ref.option = parts[2]
+	}
+	if ref.config == "" || ref.section == "" || (len(parts) > 2 && ref.option == "") {
+		return ref, errBatchArguments
+	}
+	return ref, nil
+}
+
+// exec executes a single batch command (other than commit).
+func (x *tx) exec(args []string) error {
+	cmd := args[0]
+	switch cmd {
+	case "set", "delete", "rename", "reorder", "add_list", "del_list":
+	case "add":
+		if len(args) != 3 {
+			return errBatchArguments
+		}
+		cfg, err := x.modify(args[1], true)
+		if err != nil {
+			return err
+		}
+		cfg.Add(newSection(args[2], ""))
+		x.dirty[args[1]] = true
+		return nil
+	default:
+		return fmt.Errorf("%w %q", errBatchUnknownCommand, cmd)
+	}
+
+	if len(args) != 2 {
+		return errBatchArguments
+	}
+	ref, err := parseBatchRef(args[1])
+	if err != nil {
+		return err
+	}
+	switch {
+	case ref.hasValue == (cmd == "delete"),
+		ref.option == "" && (cmd == "add_list" || cmd == "del_list"),
+		ref.option != "" && cmd == "reorder":
+		return errBatchArguments
+	}
+
+	cfg, err := x.modify(ref.config, cmd == "set" && ref.option == "")
+	if err != nil {
+		return err
+	}
+	sec := cfg.Get(ref.section)
+	if sec == nil && !(cmd == "set" && ref.option == "") {
+		return ErrSectionNotFound{Section: ref.section}
+	}
+
+	switch {
+	case cmd == "set" && ref.option == "":
+		if sec == nil {
+			cfg.Add(newSection(ref.value, ref.section))
+		} else {
+			sec.Type = ref.value
+		}
+	case cmd == "set":
+		if err = x.t.schema.checkWrite(cfg, ref.section, ref.option, TypeOption, []string{ref.value}); err != nil {
+			return err
+		}
+		if opt := sec.Get(ref.option); opt != nil {
+			opt.Type = TypeOption
+			opt.SetValues(ref.value)
+		} else {
+			sec.Add(newOption(ref.option, TypeOption, ref.value))
+		}
+	case cmd == "add_list":
+		if err = x.t.schema.checkWrite(cfg, ref.section, ref.option, TypeList, []string{ref.value}); err != nil {
+			return err
+		}
+		if opt := sec.Get(ref.option); opt != nil {
+			opt.Type = TypeList
+			opt.AddValue(ref.value)
+		} else {
+			sec.Add(newOption(ref.option, TypeList, ref.value))
+		}
+	case cmd == "del_list":
+		opt := sec.Get(ref.option)
+		if opt == nil {
+			return nil
+		}
+		values := make([]string, 0, len(opt.Values))
+		for _, v := range opt.Values {
+			if v != ref.value {
+				values = append(values, v)
+			}
+		}
+		if len(values) == 0 {
+			sec.Del(ref.option)
+		} else {
+			opt.SetValues(values...)
+		}
+	case cmd == "delete" && ref.option == "":
+		cfg.remove(sec)
+	case cmd == "delete":
+		if !sec.Del(ref.option) {
+			return nil
+		}
+	case cmd == "rename" && ref.option == "":
+		if other := cfg.Get(ref.value); other != nil && other != sec {
+			return errBatchExists
+		}
+		sec.Name = ref.value
+	case cmd == "rename":
+		opt := sec.Get(ref.option)
+		if opt == nil {
+			return errBatchArguments
+		}
+		if other := sec.Get(ref.value); other != nil && other != opt {
+			return errBatchExists
+		}
+		if err = x.t.schema.checkWrite(cfg, ref.section, ref.value, opt.Type, opt.Values); err != nil {
+			return err
+		}
+		opt.Name = ref.value
+	case cmd == "reorder":
+		pos, err := strconv.Atoi(ref.value)
+		if err != nil || pos < 0 {
+			return errBatchArguments
+		}
+		cfg.remove(sec)
+		cfg.insert(pos, sec)
+	}
+	x.dirty[ref.config] = true
+	return nil
+}
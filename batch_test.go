@@ -0,0 +1,295 @@
+package uci
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitBatchLine(t *testing.T) {
+	assert := assert.New(t)
+
+	for line, expected := range map[string][]string{
+		"set network.lan.proto=static":         {"set", "network.lan.proto=static"},
+		"  add   firewall\trule ":              {"add", "firewall", "rule"},
+		`set system.@system[0].hostname='a b'`: {"set", "system.@system[0].hostname=a b"},
+		`set foo.bar.baz='it'\''s'`:            {"set", "foo.bar.baz=it's"},
+		`set foo.bar.baz="say \"hi\""`:         {"set", `foo.bar.baz=say "hi"`},
+		`set foo.bar.baz=a\ b`:                 {"set", "foo.bar.baz=a b"},
+		`set foo.bar.baz=''`:                   {"set", "foo.bar.baz="},
+	} {
+		args, err := splitBatchLine(line)
+		assert.NoError(err, line)
+		assert.Equal(expected, args, line)
+	}
+
+	_, err := splitBatchLine("set foo.bar.baz='unterminated")
+	assert.ErrorIs(err, errBatchUnterminated)
+}
+
+func TestBatch(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "firewall", `
+config zone 'lan'
+	list network 'lan'
+	list network 'guest'
+	option input 'ACCEPT'
+
+config rule
+	option name 'Allow-Ping'
+
+config rule
+	option name 'Allow-DHCP'
+`)
+
+	r := NewTree(dir)
+	err := r.(Batcher).Batch(strings.NewReader(`
+# comment
+set firewall.wan=zone
+set firewall.wan.input='REJECT'
+add_list firewall.wan.network='wan'
+add_list firewall.wan.network='wan6'
+del_list firewall.lan.network='guest'
+delete firewall.lan.input
+add firewall forwarding
+set firewall.@forwarding[-1].src=lan
+set firewall.@forwarding[-1].dest=wan
+delete firewall.@rule[0]
+rename firewall.@rule[0]=dhcp
+rename firewall.dhcp.name=label
+reorder firewall.wan=0
+commit firewall
+`))
+	require.NoError(t, err)
+
+	body, err := os.ReadFile(filepath.Join(dir, "firewall"))
+	require.NoError(t, err)
+	assert.Equal(`
+config zone 'wan'
+	option input 'REJECT'
+	list network 'wan'
+	list network 'wan6'
+
+config zone 'lan'
+	list network 'lan'
+
+config rule 'dhcp'
+	option label 'Allow-DHCP'
+
+config forwarding
+	option src 'lan'
+	option dest 'wan'
+
+`, string(body))
+}
+
+func TestBatch_errors(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "network", "config interface 'lan'\n\toption proto 'static'\n")
+
+	r := NewTree(dir)
+	for script, line := range map[string]int{
+		"set network.lan.proto=dhcp\nset network.wan.proto=dhcp\n": 2,
+		"foo network.lan\n":                                   1,
+		"set network.lan.proto\n":                             1,
+		"delete network.lan=foo\n":                            1,
+		"add_list network.lan=foo\n":                          1,
+		"reorder network.lan=x\n":                             1,
+		"\n\nset network.lan.proto='dhcp\n":                   3,
+		"set network.wan=interface\nrename network.wan=lan\n": 2,
+		"commit network lan\n":                                1,
+	} {
+		err := r.(Batcher).Batch(strings.NewReader(script))
+		var berr *BatchError
+		if assert.ErrorAs(err, &berr, script) {
+			assert.Equal(line, berr.Line, script)
+		}
+
+		// nothing has been changed
+		proto, _ := r.GetLast("network", "lan", "proto")
+		assert.Equal("static", proto)
+		sections, _ := r.GetSections("network", "interface")
+		assert.Equal([]string{"lan"}, sections)
+	}
+
+	err := r.(Batcher).Batch(strings.NewReader("set network.wan.proto=dhcp\n"))
+	assert.ErrorIs(err, ErrSectionNotFound{Section: "wan"})
+	assert.EqualError(err, "batch: line 1: section wan not found")
+}
+
+func TestEncodeBatch(t *testing.T) {
+	const old = `
+config defaults
+	option input 'ACCEPT'
+
+config zone 'lan'
+	list network 'lan'
+	list network 'guest'
+
+config zone 'wan'
+	list network 'wan'
+
+config redirect 'ssh'
+	option src_dport '22'
+
+config rule
+	option name 'Allow-Ping'
+
+config rule
+	option name 'Allow-DHCP'
+
+config rule
+	option name 'Allow-IGMP'
+`
+	const cur = `
+config rule
+	option name 'Allow-IGMP'
+
+config defaults
+	option input 'REJECT'
+	option forward "it's"
+
+config zone 'wan'
+	list network 'wan'
+	list network 'wan6'
+
+config zone 'lan'
+	list network 'iot'
+	list network 'lan'
+
+config rule 'ssh'
+	option src_dport '22'
+
+config rule
+	option name 'Allow-DHCP'
+
+config include
+	option path '/etc/firewall.user'
+
+config rule
+	option name 'Allow-Ping'
+`
+	for _, opts := range []BatchOptions{{}, {DiffOptions: DiffOptions{MatchContent: true}}} {
+		a := testSnapshot(t, "firewall", old)
+		b := testSnapshot(t, "firewall", cur)
+
+		var script bytes.Buffer
+		require.NoError(t, EncodeBatch(&script, a, b, opts))
+
+		dir := t.TempDir()
+		writeTestConfig(t, dir, "firewall", old)
+		r := NewTree(dir)
+		require.NoError(t, r.(Batcher).Batch(&script), script.String())
+
+		s, err := r.Snapshot("firewall")
+		require.NoError(t, err)
+		assert.Empty(t, DiffConfig(s, b, "firewall", DiffOptions{}), script.String())
+		assert.True(t, s.configs["firewall"].equal(b.configs["firewall"]), script.String())
+	}
+}
+
+func TestEncodeBatch_rename(t *testing.T) {
+	assert := assert.New(t)
+	const old = `
+config zone 'lan'
+	list network 'lan'
+
+config zone 'wan'
+	list network 'wan'
+
+config zone 'dmz'
+	list network 'dmz'
+`
+	const cur = `
+config zone 'lan'
+	list network 'lan'
+
+config zone 'internet'
+	list network 'wan'
+
+config zone 'dmz2'
+	list network 'dmz'
+	option input 'REJECT'
+`
+	a := testSnapshot(t, "firewall", old)
+	b := testSnapshot(t, "firewall", cur)
+
+	var script bytes.Buffer
+	require.NoError(t, EncodeBatch(&script, a, b, BatchOptions{}))
+	assert.Equal(`delete firewall.dmz
+rename firewall.wan='internet'
+set firewall.dmz2='zone'
+add_list firewall.dmz2.network='dmz'
+set firewall.dmz2.input='REJECT'
+`, script.String())
+
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "firewall", old)
+	r := NewTree(dir)
+	require.NoError(t, r.(Batcher).Batch(&script))
+	s, err := r.Snapshot("firewall")
+	require.NoError(t, err)
+	assert.True(s.configs["firewall"].equal(b.configs["firewall"]))
+}
+
+func TestEncodeBatch_newline(t *testing.T) {
+	a := testSnapshot(t, "system", "config system\n")
+	b := testSnapshot(t, "system", "config system\n")
+	b.configs["system"].Sections[0].Add(newOption("notes", TypeOption, "line 1\nline 2"))
+
+	var script bytes.Buffer
+	err := EncodeBatch(&script, a, b, BatchOptions{})
+	assert.ErrorIs(t, err, errBatchNewline)
+	assert.Empty(t, script.String())
+}
+
+func TestExportBatch(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "network", "config interface 'lan'\n\toption proto 'static'\n\nconfig interface 'wan'\n")
+
+	r := NewTree(dir)
+	require.NoError(t, r.SetType("network", "lan", "proto", TypeOption, "dhcp"))
+	require.NoError(t, r.AddSection("network", "guest", "interface"))
+	require.NoError(t, r.SetType("network", "guest", "dns", TypeList, "1.1.1.1", "8.8.8.8"))
+	require.NoError(t, r.DelSection("network", "wan"))
+	require.NoError(t, r.AddSection("system", "main", "system"))
+
+	var buf bytes.Buffer
+	require.NoError(t, r.(Batcher).ExportBatch(&buf))
+	assert.Equal(`delete network.wan
+set network.guest='interface'
+set network.lan.proto='dhcp'
+add_list network.guest.dns='1.1.1.1'
+add_list network.guest.dns='8.8.8.8'
+set system.main='system'
+`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, r.(Batcher).ExportBatch(&buf, "system"))
+	assert.Equal("set system.main='system'\n", buf.String())
+}
+
+func TestBatcher(t *testing.T) {
+	assert := assert.New(t)
+	r := NewTree(t.TempDir())
+
+	assert.Implements((*Batcher)(nil), r)
+	assert.Implements((*Batcher)(nil), ReadOnly(r))
+	assert.Implements((*Batcher)(nil), r.(Cloner).Clone())
+
+	// forks of trees without batch support
+	f := &Fork{Tree: struct{ Tree }{r}}
+	var nsErr ErrNotSupported
+	assert.ErrorAs(f.ExportBatch(&bytes.Buffer{}), &nsErr)
+	assert.Equal("ExportBatch", nsErr.Op)
+	assert.ErrorAs(f.Batch(strings.NewReader("commit\n")), &nsErr)
+	assert.Equal("Batch", nsErr.Op)
+}
@@ -1,5 +1,12 @@
 package uci
 
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+)
+
 // DefaultTreePath points to the default UCI location.
 const DefaultTreePath = "/etc/config"
 
@@ -12,8 +19,17 @@ func LoadConfig(name string, forceReload bool) error {
 }
 
 // Commit delegates to the default tree. See Tree for details.
-func Commit() error {
-	return defaultTree.Commit()
+func Commit(configs ...string) error {
+	return defaultTree.Commit(configs...)
+}
+
+// Apply delegates to the default tree. See Applier for details.
+func Apply(timeout time.Duration, clock Clock) (*ApplySession, error) {
+	a, err := optional[Applier](defaultTree, "Apply")
+	if err != nil {
+		return nil, err
+	}
+	return a.Apply(timeout, clock)
 }
 
 // Revert delegates to the default tree. See Tree for details.
@@ -21,6 +37,16 @@ func Revert(configs ...string) {
 	defaultTree.Revert(configs...)
 }
 
+// RevertSection delegates to the default tree. See Tree for details.
+func RevertSection(config, section string) error {
+	return defaultTree.RevertSection(config, section)
+}
+
+// RevertOption delegates to the default tree. See Tree for details.
+func RevertOption(config, section, option string) error {
+	return defaultTree.RevertOption(config, section, option)
+}
+
 // GetSections delegates to the default tree. See Tree for details.
 func GetSections(config, secType string) ([]string, error) {
 	return defaultTree.GetSections(config, secType)
@@ -41,6 +67,11 @@ func GetBool(config, section, option string) (bool, bool) {
 	return defaultTree.GetBool(config, section, option)
 }
 
+// Snapshot delegates to the default tree. See Tree for details.
+func Snapshot(configs ...string) (*TreeSnapshot, error) {
+	return defaultTree.Snapshot(configs...)
+}
+
 // Del delegates to the default tree. See Tree for details.
 func Del(config, section, option string) error {
 	return defaultTree.Del(config, section, option)
@@ -55,3 +86,178 @@ func AddSection(config, section, typ string) error {
 func DelSection(config, section string) error {
 	return defaultTree.DelSection(config, section)
 }
+
+// ExportBatch delegates to the default tree. See Batcher for details.
+func ExportBatch(w io.Writer, configs ...string) error {
+	b, err := optional[Batcher](defaultTree, "ExportBatch")
+	if err != nil {
+		return err
+	}
+	return b.ExportBatch(w, configs...)
+}
+
+// Batch delegates to the default tree. See Batcher for details.
+func Batch(r io.Reader) error {
+	b, err := optional[Batcher](defaultTree, "Batch")
+	if err != nil {
+		return err
+	}
+	return b.Batch(r)
+}
+
+// Clone delegates to the default tree. See Cloner for details. It
+// returns nil, if the default tree does not implement Cloner.
+func Clone() *Fork {
+	c, err := optional[Cloner](defaultTree, "Clone")
+	if err != nil {
+		return nil
+	}
+	return c.Clone()
+}
+
+// GetPath delegates to the default tree. See PathAccessor for details.
+func GetPath(p Path) ([]string, error) {
+	pa, err := optional[PathAccessor](defaultTree, "GetPath")
+	if err != nil {
+		return nil, err
+	}
+	return pa.GetPath(p)
+}
+
+// SetPath delegates to the default tree. See PathAccessor for details.
+func SetPath(p Path, values ...string) error {
+	pa, err := optional[PathAccessor](defaultTree, "SetPath")
+	if err != nil {
+		return err
+	}
+	return pa.SetPath(p, values...)
+}
+
+// AddPath delegates to the default tree. See PathAccessor for details.
+func AddPath(p Path, values ...string) error {
+	pa, err := optional[PathAccessor](defaultTree, "AddPath")
+	if err != nil {
+		return err
+	}
+	return pa.AddPath(p, values...)
+}
+
+// DelPath delegates to the default tree. See PathAccessor for details.
+func DelPath(p Path) error {
+	pa, err := optional[PathAccessor](defaultTree, "DelPath")
+	if err != nil {
+		return err
+	}
+	return pa.DelPath(p)
+}
+
+// Import delegates to the default tree. See Importer for details.
+func Import(config string, r io.Reader, mode ImportMode) error {
+	i, err := optional[Importer](defaultTree, "Import")
+	if err != nil {
+		return err
+	}
+	return i.Import(config, r, mode)
+}
+
+// Update delegates to the default tree. See Tree for details.
+func Update(fn func(tx Tx) error) error {
+	return defaultTree.Update(fn)
+}
+
+// Backup delegates to the default tree. See Archiver for details.
+func Backup(w io.Writer, configs ...string) error {
+	a, err := optional[Archiver](defaultTree, "Backup")
+	if err != nil {
+		return err
+	}
+	return a.Backup(w, configs...)
+}
+
+// Restore delegates to the default tree. See Archiver for details.
+func Restore(r io.Reader) error {
+	a, err := optional[Archiver](defaultTree, "Restore")
+	if err != nil {
+		return err
+	}
+	return a.Restore(r)
+}
+
+// SetFileMode delegates to the default tree. See FileModeSetter for
+// details.
+func SetFileMode(config string, mode os.FileMode) {
+	if fm, err := optional[FileModeSetter](defaultTree, "SetFileMode"); err == nil {
+		fm.SetFileMode(config, mode)
+	}
+}
+
+// Watch delegates to the default tree. See Watcher for details.
+func Watch(ctx context.Context) (<-chan WatchEvent, error) {
+	return watchTree(ctx, defaultTree)
+}
+
+// DryRun delegates to the default tree. See DryRunner for details.
+func DryRun(configs ...string) ([]FileDiff, error) {
+	dr, err := optional[DryRunner](defaultTree, "DryRun")
+	if err != nil {
+		return nil, err
+	}
+	return dr.DryRun(configs...)
+}
+
+// AddValidator delegates to the default tree. See ValidatorRegistrar for
+// details.
+func AddValidator(config string, v Validator) {
+	if vr, err := optional[ValidatorRegistrar](defaultTree, "AddValidator"); err == nil {
+		vr.AddValidator(config, v)
+	}
+}
+
+// SetSchema delegates to the default tree. See Tree for details.
+func SetSchema(s *Schema) {
+	defaultTree.SetSchema(s)
+}
+
+// SetHistory delegates to the default tree. See HistoryKeeper for
+// details.
+func SetHistory(h *History) {
+	if hk, err := optional[HistoryKeeper](defaultTree, "SetHistory"); err == nil {
+		hk.SetHistory(h)
+	}
+}
+
+// CommitWithMessage delegates to the default tree. See HistoryKeeper for
+// details.
+func CommitWithMessage(message string, configs ...string) error {
+	hk, err := optional[HistoryKeeper](defaultTree, "CommitWithMessage")
+	if err != nil {
+		return err
+	}
+	return hk.CommitWithMessage(message, configs...)
+}
+
+// RestoreVersion delegates to the default tree. See HistoryKeeper for
+// details.
+func RestoreVersion(config string, id int) error {
+	hk, err := optional[HistoryKeeper](defaultTree, "RestoreVersion")
+	if err != nil {
+		return err
+	}
+	return hk.RestoreVersion(config, id)
+}
+
+// AddPreCommitHook delegates to the default tree. See HookRegistrar for
+// details.
+func AddPreCommitHook(h CommitHook) {
+	if hr, err := optional[HookRegistrar](defaultTree, "AddPreCommitHook"); err == nil {
+		hr.AddPreCommitHook(h)
+	}
+}
+
+// AddPostCommitHook delegates to the default tree. See HookRegistrar for
+// details.
+func AddPostCommitHook(h CommitHook) {
+	if hr, err := optional[HookRegistrar](defaultTree, "AddPostCommitHook"); err == nil {
+		hr.AddPostCommitHook(h)
+	}
+}
@@ -1,10 +1,13 @@
 package uci
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"io"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -21,15 +24,67 @@ func (m *mockTree) LoadConfig(name string, forceReload bool) error {
 	return args.Error(0)
 }
 
-func (m *mockTree) Commit() error {
-	args := m.Called()
+func (m *mockTree) Commit(configs ...string) error {
+	args := m.Called(configs)
+	return args.Error(0)
+}
+
+func (m *mockTree) DryRun(configs ...string) ([]FileDiff, error) {
+	args := m.Called(configs)
+	diffs, _ := args.Get(0).([]FileDiff)
+	return diffs, args.Error(1)
+}
+
+func (m *mockTree) AddValidator(config string, v Validator) {
+	m.Called(config, v)
+}
+
+func (m *mockTree) SetSchema(s *Schema) {
+	m.Called(s)
+}
+
+func (m *mockTree) SetHistory(h *History) {
+	m.Called(h)
+}
+
+func (m *mockTree) CommitWithMessage(message string, configs ...string) error {
+	args := m.Called(message, configs)
 	return args.Error(0)
 }
 
+func (m *mockTree) RestoreVersion(config string, id int) error {
+	args := m.Called(config, id)
+	return args.Error(0)
+}
+
+func (m *mockTree) AddPreCommitHook(h CommitHook) {
+	m.Called(h)
+}
+
+func (m *mockTree) AddPostCommitHook(h CommitHook) {
+	m.Called(h)
+}
+
+func (m *mockTree) Apply(timeout time.Duration, clock Clock) (*ApplySession, error) {
+	args := m.Called(timeout, clock)
+	s, _ := args.Get(0).(*ApplySession)
+	return s, args.Error(1)
+}
+
 func (m *mockTree) Revert(configs ...string) {
 	m.Called(configs)
 }
 
+func (m *mockTree) RevertSection(config, section string) error {
+	args := m.Called(config, section)
+	return args.Error(0)
+}
+
+func (m *mockTree) RevertOption(config, section, option string) error {
+	args := m.Called(config, section, option)
+	return args.Error(0)
+}
+
 func (m *mockTree) GetSections(config string, secType string) ([]string, error) {
 	args := m.Called(config, secType)
 	return []string{args.String(0)}, args.Error(1)
@@ -50,6 +105,12 @@ func (m *mockTree) GetBool(config, section, option string) (bool, bool) {
 	return args.Bool(0), args.Bool(1)
 }
 
+func (m *mockTree) Snapshot(configs ...string) (*TreeSnapshot, error) {
+	args := m.Called(configs)
+	s, _ := args.Get(0).(*TreeSnapshot)
+	return s, args.Error(1)
+}
+
 func (m *mockTree) SetType(config, section, option string, typ OptionType, values ...string) error {
 	args := m.Called(config, section, option, typ, values)
 	return args.Error(0)
@@ -70,6 +131,73 @@ func (m *mockTree) DelSection(config, section string) error {
 	return nil
 }
 
+func (m *mockTree) ExportBatch(w io.Writer, configs ...string) error {
+	args := m.Called(w, configs)
+	return args.Error(0)
+}
+
+func (m *mockTree) Batch(r io.Reader) error {
+	args := m.Called(r)
+	return args.Error(0)
+}
+
+func (m *mockTree) Clone() *Fork {
+	args := m.Called()
+	f, _ := args.Get(0).(*Fork)
+	return f
+}
+
+func (m *mockTree) GetPath(p Path) ([]string, error) {
+	args := m.Called(p)
+	values, _ := args.Get(0).([]string)
+	return values, args.Error(1)
+}
+
+func (m *mockTree) SetPath(p Path, values ...string) error {
+	args := m.Called(p, values)
+	return args.Error(0)
+}
+
+func (m *mockTree) AddPath(p Path, values ...string) error {
+	args := m.Called(p, values)
+	return args.Error(0)
+}
+
+func (m *mockTree) DelPath(p Path) error {
+	args := m.Called(p)
+	return args.Error(0)
+}
+
+func (m *mockTree) Import(config string, r io.Reader, mode ImportMode) error {
+	args := m.Called(config, r, mode)
+	return args.Error(0)
+}
+
+func (m *mockTree) Update(fn func(tx Tx) error) error {
+	args := m.Called(fn)
+	return args.Error(0)
+}
+
+func (m *mockTree) Backup(w io.Writer, configs ...string) error {
+	args := m.Called(w, configs)
+	return args.Error(0)
+}
+
+func (m *mockTree) Restore(r io.Reader) error {
+	args := m.Called(r)
+	return args.Error(0)
+}
+
+func (m *mockTree) SetFileMode(config string, mode os.FileMode) {
+	m.Called(config, mode)
+}
+
+func (m *mockTree) Watch(ctx context.Context) (<-chan WatchEvent, error) {
+	args := m.Called(ctx)
+	ch, _ := args.Get(0).(<-chan WatchEvent)
+	return ch, args.Error(1)
+}
+
 func TestMain(m *testing.M) {
 	defaultTree = &mockTree{}
 	os.Exit(m.Run())
@@ -89,8 +217,20 @@ func TestConvenienceLoadConfig(t *testing.T) {
 func TestConvenienceCommit(t *testing.T) {
 	assert := assert.New(t)
 	m := defaultTree.(*mockTree)
-	m.On("Commit").Return(nil)
+	m.On("Commit", []string(nil)).Return(nil)
+	m.On("Commit", []string{"foo"}).Return(nil)
 	assert.NoError(Commit())
+	assert.NoError(Commit("foo"))
+	m.AssertExpectations(t)
+}
+
+func TestConvenienceApply(t *testing.T) {
+	assert := assert.New(t)
+	m := defaultTree.(*mockTree)
+	m.On("Apply", 30*time.Second, nil).Return(&ApplySession{}, nil)
+	s, err := Apply(30*time.Second, nil)
+	assert.NoError(err)
+	assert.NotNil(s)
 	m.AssertExpectations(t)
 }
 
@@ -101,6 +241,16 @@ func TestConvenienceRevert(t *testing.T) {
 	m.AssertExpectations(t)
 }
 
+func TestConvenienceRevertPartial(t *testing.T) {
+	assert := assert.New(t)
+	m := defaultTree.(*mockTree)
+	m.On("RevertSection", "foo", "bar").Return(nil)
+	m.On("RevertOption", "foo", "bar", "opt").Return(nil)
+	assert.NoError(RevertSection("foo", "bar"))
+	assert.NoError(RevertOption("foo", "bar", "opt"))
+	m.AssertExpectations(t)
+}
+
 func TestConvenienceGetSections(t *testing.T) {
 	assert := assert.New(t)
 	m := defaultTree.(*mockTree)
@@ -169,3 +319,138 @@ func TestConvenienceDelSection(t *testing.T) {
 	assert.NoError(t, err)
 	m.AssertExpectations(t)
 }
+
+func TestConvenienceSnapshot(t *testing.T) {
+	assert := assert.New(t)
+	m := defaultTree.(*mockTree)
+	m.On("Snapshot", []string{"foo"}).Return(&TreeSnapshot{}, nil)
+	s, err := Snapshot("foo")
+	assert.NoError(err)
+	assert.NotNil(s)
+	m.AssertExpectations(t)
+}
+
+func TestConvenienceBatch(t *testing.T) {
+	assert := assert.New(t)
+	m := defaultTree.(*mockTree)
+	var buf bytes.Buffer
+	m.On("ExportBatch", &buf, []string{"foo"}).Return(nil)
+	m.On("Batch", &buf).Return(nil)
+	assert.NoError(ExportBatch(&buf, "foo"))
+	assert.NoError(Batch(&buf))
+	m.AssertExpectations(t)
+}
+
+func TestConvenienceClone(t *testing.T) {
+	m := defaultTree.(*mockTree)
+	m.On("Clone").Return(&Fork{})
+	assert.NotNil(t, Clone())
+	m.AssertExpectations(t)
+}
+
+func TestConveniencePath(t *testing.T) {
+	assert := assert.New(t)
+	m := defaultTree.(*mockTree)
+	p := Path{Config: "network", Section: "lan", Option: "dns"}
+	m.On("GetPath", p).Return([]string{"1.1.1.1"}, nil)
+	m.On("SetPath", p, []string{"8.8.8.8"}).Return(nil)
+	m.On("AddPath", p, []string{"9.9.9.9"}).Return(nil)
+	m.On("DelPath", p).Return(nil)
+	values, err := GetPath(p)
+	assert.NoError(err)
+	assert.Equal([]string{"1.1.1.1"}, values)
+	assert.NoError(SetPath(p, "8.8.8.8"))
+	assert.NoError(AddPath(p, "9.9.9.9"))
+	assert.NoError(DelPath(p))
+	m.AssertExpectations(t)
+}
+
+func TestConvenienceImport(t *testing.T) {
+	m := defaultTree.(*mockTree)
+	r := bytes.NewBufferString("config interface 'lan'\n")
+	m.On("Import", "network", r, ImportMergeReplaceLists).Return(nil)
+	assert.NoError(t, Import("network", r, ImportMergeReplaceLists))
+	m.AssertExpectations(t)
+}
+
+func TestConvenienceUpdate(t *testing.T) {
+	m := defaultTree.(*mockTree)
+	m.On("Update", mock.Anything).Return(nil)
+	assert.NoError(t, Update(func(Tx) error { return nil }))
+	m.AssertExpectations(t)
+}
+
+func TestConvenienceBackup(t *testing.T) {
+	assert := assert.New(t)
+	m := defaultTree.(*mockTree)
+	var buf bytes.Buffer
+	m.On("Backup", &buf, []string{"foo"}).Return(nil)
+	m.On("Restore", &buf).Return(nil)
+	assert.NoError(Backup(&buf, "foo"))
+	assert.NoError(Restore(&buf))
+	m.AssertExpectations(t)
+}
+
+func TestConvenienceSetFileMode(t *testing.T) {
+	m := defaultTree.(*mockTree)
+	m.On("SetFileMode", "wireless", os.FileMode(0o600)).Return()
+	SetFileMode("wireless", 0o600)
+	m.AssertExpectations(t)
+}
+
+func TestConvenienceWatch(t *testing.T) {
+	assert := assert.New(t)
+	m := defaultTree.(*mockTree)
+	ctx := context.Background()
+	m.On("Watch", ctx).Return(nil, ErrWatchNotSupported)
+	_, err := Watch(ctx)
+	assert.ErrorIs(err, ErrWatchNotSupported)
+	m.AssertExpectations(t)
+}
+
+func TestConvenienceDryRun(t *testing.T) {
+	assert := assert.New(t)
+	m := defaultTree.(*mockTree)
+	m.On("DryRun", []string{"foo"}).Return([]FileDiff{{Config: "foo"}}, nil)
+	diffs, err := DryRun("foo")
+	assert.NoError(err)
+	assert.Equal([]FileDiff{{Config: "foo"}}, diffs)
+	m.AssertExpectations(t)
+}
+
+func TestConvenienceAddValidator(t *testing.T) {
+	m := defaultTree.(*mockTree)
+	m.On("AddValidator", "network", mock.Anything).Return()
+	AddValidator("network", func(ConfigView) error { return nil })
+	m.AssertExpectations(t)
+}
+
+func TestConvenienceSchema(t *testing.T) {
+	m := defaultTree.(*mockTree)
+	s := &Schema{}
+	m.On("SetSchema", s).Return()
+	SetSchema(s)
+	m.AssertExpectations(t)
+}
+
+func TestConvenienceHistory(t *testing.T) {
+	assert := assert.New(t)
+	m := defaultTree.(*mockTree)
+	h := NewHistory("/tmp/history", 5)
+	m.On("SetHistory", h).Return()
+	m.On("CommitWithMessage", "msg", []string{"foo"}).Return(nil)
+	m.On("RestoreVersion", "foo", 3).Return(ErrNoHistory)
+	SetHistory(h)
+	assert.NoError(CommitWithMessage("msg", "foo"))
+	assert.ErrorIs(RestoreVersion("foo", 3), ErrNoHistory)
+	m.AssertExpectations(t)
+}
+
+func TestConvenienceCommitHooks(t *testing.T) {
+	m := defaultTree.(*mockTree)
+	m.On("AddPreCommitHook", mock.Anything).Return()
+	m.On("AddPostCommitHook", mock.Anything).Return()
+	AddPreCommitHook(func([]string) error { return nil })
+	AddPostCommitHook(func([]string) error { return nil })
+	m.AssertExpectations(t)
+}
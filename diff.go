@@ -0,0 +1,434 @@
+package uci
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ChangeType describes the kind of modification reported in a Change.
+type ChangeType int
+
+const (
+	SectionAdded   ChangeType = iota + 1 // section exists only in the new config
+	SectionRemoved                       // section exists only in the old config
+	OptionSet                            // option was added or its values changed
+	OptionRemoved                        // option exists only in the old config
+	SectionRetyped                       // section type was changed
+	SectionMoved                         // section position was changed
+	ListAdded                            // entries were appended to a list
+	ListRemoved                          // entries were removed from a list
+)
+
+func (ct ChangeType) String() string {
+	switch ct {
+	case SectionAdded:
+		return "section-added"
+	case SectionRemoved:
+		return "section-removed"
+	case OptionSet:
+		return "option-set"
+	case OptionRemoved:
+		return "option-removed"
+	case SectionRetyped:
+		return "section-retyped"
+	case SectionMoved:
+		return "section-moved"
+	case ListAdded:
+		return "list-added"
+	case ListRemoved:
+		return "list-removed"
+	}
+	return fmt.Sprintf("ChangeType(%d)", int(ct))
+}
+
+// A Change describes a single difference between two versions of a
+// config. Section holds the section name, or its synthetic name (e.g.
+// "@rule[2]") for unnamed sections. For option changes, Option holds the
+// option name, and Values the new values (if any). For list changes,
+// Values holds the added or removed entries.
+//
+// OldType and Index are only used by SectionRetyped and SectionMoved,
+// respectively. Index is the new position of the section within the
+// config (counting all sections). It is always included in the JSON
+// encoding, since 0 is a valid position.
+type Change struct {
+	Type        ChangeType `json:"type"`
+	Section     string     `json:"section"`
+	SectionType string     `json:"section_type"`
+	OldType     string     `json:"old_type,omitempty"`
+	Index       int        `json:"index"`
+	Option      string     `json:"option,omitempty"`
+	Values      []string   `json:"values,omitempty"`
+}
+
+func (c Change) String() string {
+	switch c.Type { //nolint:exhaustive
+	case SectionAdded, SectionRemoved:
+		return fmt.Sprintf("%s %s=%s", c.Type, c.Section, c.SectionType)
+	case SectionRetyped:
+		return fmt.Sprintf("%s %s=%s (was %s)", c.Type, c.Section, c.SectionType, c.OldType)
+	case SectionMoved:
+		return fmt.Sprintf("%s %s=%s to %d", c.Type, c.Section, c.SectionType, c.Index)
+	case OptionSet, ListAdded, ListRemoved:
+		return fmt.Sprintf("%s %s.%s=%q", c.Type, c.Section, c.Option, c.Values)
+	}
+	return fmt.Sprintf("%s %s.%s", c.Type, c.Section, c.Option)
+}
+
+// diffConfigs compares two versions of the same config, and returns the
+// changes needed to turn the old version into the new one. Sections are
+// matched by their (possibly synthetic) name.
+func diffConfigs(old, cur *config) []Change {
+	var changes []Change
+
+	for _, sec := range old.Sections {
+		name := old.sectionName(sec)
+		if cur.Get(name) == nil {
+			changes = append(changes, Change{
+				Type:        SectionRemoved,
+				Section:     name,
+				SectionType: sec.Type,
+			})
+		}
+	}
+
+	for _, sec := range cur.Sections {
+		name := cur.sectionName(sec)
+		prev := old.Get(name)
+		if prev == nil || prev.Type != sec.Type {
+			if prev != nil {
+				changes = append(changes, Change{
+					Type:        SectionRemoved,
+					Section:     name,
+					SectionType: prev.Type,
+				})
+			}
+			changes = append(changes, Change{
+				Type:        SectionAdded,
+				Section:     name,
+				SectionType: sec.Type,
+			})
+			prev = newSection(sec.Type, sec.Name)
+		}
+		changes = append(changes, diffOptions(name, prev, sec, false)...)
+	}
+
+	return changes
+}
+
+func equalValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// DiffOptions controls DiffConfig and DiffTrees.
+type DiffOptions struct {
+	// MatchContent matches unnamed sections by their content: a section
+	// is considered unchanged, if an unnamed section of the same type
+	// with the same options exists on the other side (even at another
+	// position). The remaining unnamed sections are matched by position,
+	// which is the default for all unnamed sections.
+	MatchContent bool
+}
+
+// DiffConfig compares a config in two snapshots, and returns the changes
+// needed to turn the version in a into the version in b. A config missing
+// in a snapshot is treated as empty.
+//
+// In contrast to the changes reported elsewhere (e.g. by Watcher.Watch),
+// sections are matched by name (named sections) or according to opts
+// (unnamed sections). Type changes of named sections are reported as
+// SectionRetyped, changes of the section order as SectionMoved, and
+// changes to lists (where possible) as ListRemoved and ListAdded. The
+// latter follow the semantics of "uci del_list" (removing all
+// occurrences of a value) and "uci add_list" (appending a value).
+//
+// Removed sections are reported first (using their name in a), then all
+// other changes in the order of the sections in b (using their name in
+// b).
+func DiffConfig(a, b *TreeSnapshot, config string, opts DiffOptions) []Change {
+	old, ok := a.configs[config]
+	if !ok {
+		old = newConfig(config)
+	}
+	cur, ok := b.configs[config]
+	if !ok {
+		cur = newConfig(config)
+	}
+	return semanticDiff(old, cur, opts)
+}
+
+// DiffTrees compares the given configs (or all configs loaded in either
+// tree, if none are given) of two trees, e.g. the current state of a
+// device and a desired state. A config loaded in one tree only is
+// compared to its on-disk version in the other tree (or to an empty
+// config, if missing there). See DiffConfig for details. Only configs
+// with changes are included in the result.
+func DiffTrees(a, b Tree, opts DiffOptions, configs ...string) (map[string][]Change, error) {
+	sa, err := a.Snapshot(configs...)
+	if err != nil {
+		return nil, err
+	}
+	sb, err := b.Snapshot(configs...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(configs) == 0 {
+		configs = appendUnique(sa.Configs(), sb.Configs()...)
+		if err = addMissing(a, sa, configs); err != nil {
+			return nil, err
+		}
+		if err = addMissing(b, sb, configs); err != nil {
+			return nil, err
+		}
+	}
+	diffs := make(map[string][]Change)
+	for _, name := range configs {
+		if changes := DiffConfig(sa, sb, name, opts); len(changes) > 0 {
+			diffs[name] = changes
+		}
+	}
+	return diffs, nil
+}
+
+// addMissing adds the named configs missing in s, as loaded from t. See
+// snapshotOrEmpty.
+func addMissing(t Tree, s *TreeSnapshot, names []string) error {
+	var missing []string
+	for _, name := range names {
+		if _, ok := s.configs[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	extra, err := snapshotOrEmpty(t, missing)
+	if err != nil {
+		return err
+	}
+	for name, cfg := range extra.configs {
+		s.configs[name] = cfg
+	}
+	return nil
+}
+
+// semanticDiff implements DiffConfig.
+func semanticDiff(old, cur *config, opts DiffOptions) []Change {
+	match := matchSections(old, cur, opts)
+
+	var changes []Change
+	matched := make([]bool, len(old.Sections))
+	for _, i := range match {
+		if i >= 0 {
+			matched[i] = true
+		}
+	}
+	for i, sec := range old.Sections {
+		if !matched[i] {
+			changes = append(changes, Change{
+				Type:        SectionRemoved,
+				Section:     old.sectionName(sec),
+				SectionType: sec.Type,
+			})
+		}
+	}
+
+	stay := stableSections(match)
+	for j, sec := range cur.Sections {
+		name := cur.sectionName(sec)
+		if match[j] < 0 {
+			changes = append(changes, Change{
+				Type:        SectionAdded,
+				Section:     name,
+				SectionType: sec.Type,
+			})
+			changes = append(changes, diffOptions(name, newSection(sec.Type, sec.Name), sec, true)...)
+			continue
+		}
+
+		prev := old.Sections[match[j]]
+		if prev.Type != sec.Type {
+			changes = append(changes, Change{
+				Type:        SectionRetyped,
+				Section:     name,
+				SectionType: sec.Type,
+				OldType:     prev.Type,
+			})
+		}
+		if !stay[j] {
+			changes = append(changes, Change{
+				Type:        SectionMoved,
+				Section:     name,
+				SectionType: sec.Type,
+				Index:       j,
+			})
+		}
+		changes = append(changes, diffOptions(name, prev, sec, true)...)
+	}
+	return changes
+}
+
+// matchSections returns for each section in cur the index of the
+// corresponding section in old, or -1.
+func matchSections(old, cur *config, opts DiffOptions) []int {
+	match := make([]int, len(cur.Sections))
+	used := make([]bool, len(old.Sections))
+
+	named := make(map[string]int)
+	for i, sec := range old.Sections {
+		if sec.Name != "" {
+			named[sec.Name] = i
+		}
+	}
+	for j, sec := range cur.Sections {
+		match[j] = -1
+		if i, ok := named[sec.Name]; ok && sec.Name != "" {
+			match[j] = i
+			used[i] = true
+		}
+	}
+
+	// pair unnamed sections with the first unused candidate of the same
+	// type, for which same returns true
+	pair := func(same func(a, b *section) bool) {
+		for j, sec := range cur.Sections {
+			if sec.Name != "" || match[j] >= 0 {
+				continue
+			}
+			for i, prev := range old.Sections {
+				if !used[i] && prev.Name == "" && prev.Type == sec.Type && same(prev, sec) {
+					match[j] = i
+					used[i] = true
+					break
+				}
+			}
+		}
+	}
+	if opts.MatchContent {
+		pair(equalSections)
+	}
+	pair(func(_, _ *section) bool { return true })
+	return match
+}
+
+// stableSections determines, which of the matched sections keep their
+// relative order (the longest increasing subsequence of old indices).
+// All other matched sections are considered moved.
+func stableSections(match []int) []bool {
+	var tails []int // tails[k]: last element of best subsequence of length k+1
+	prev := make([]int, len(match))
+	for j, i := range match {
+		prev[j] = -1
+		if i < 0 {
+			continue
+		}
+		k := sort.Search(len(tails), func(k int) bool { return match[tails[k]] >= i })
+		if k > 0 {
+			prev[j] = tails[k-1]
+		}
+		if k == len(tails) {
+			tails = append(tails, j)
+		} else {
+			tails[k] = j
+		}
+	}
+
+	stay := make([]bool, len(match))
+	if len(tails) > 0 {
+		for j := tails[len(tails)-1]; j >= 0; j = prev[j] {
+			stay[j] = true
+		}
+	}
+	return stay
+}
+
+// diffOptions compares the options of two sections. If lists is true,
+// list changes are reported as ListRemoved/ListAdded, where possible.
+func diffOptions(name string, old, cur *section, lists bool) []Change {
+	var changes []Change
+
+	for _, opt := range old.Options {
+		if cur.Get(opt.Name) == nil {
+			changes = append(changes, Change{
+				Type:        OptionRemoved,
+				Section:     name,
+				SectionType: cur.Type,
+				Option:      opt.Name,
+			})
+		}
+	}
+	for _, opt := range cur.Options {
+		prev := old.Get(opt.Name)
+		if prev != nil && prev.Type == opt.Type && equalValues(prev.Values, opt.Values) {
+			continue
+		}
+		change := Change{
+			Section:     name,
+			SectionType: cur.Type,
+			Option:      opt.Name,
+		}
+		if lists && prev != nil && prev.Type == TypeList && opt.Type == TypeList {
+			if removed, added, ok := diffList(prev.Values, opt.Values); ok {
+				if len(removed) > 0 {
+					change.Type, change.Values = ListRemoved, removed
+					changes = append(changes, change)
+				}
+				if len(added) > 0 {
+					change.Type, change.Values = ListAdded, added
+					changes = append(changes, change)
+				}
+				continue
+			}
+		}
+		change.Type, change.Values = OptionSet, opt.Values
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// diffList determines the entries to remove from old (all occurrences)
+// and then to append, to get cur. It returns false, if cur cannot be
+// reached this way (e.g. if the entries were reordered).
+func diffList(old, cur []string) (removed, added []string, ok bool) {
+	keep := make(map[string]bool, len(cur))
+	for _, v := range cur {
+		keep[v] = true
+	}
+
+	var rest []string
+	for _, v := range old {
+		if keep[v] {
+			rest = append(rest, v)
+		} else {
+			removed = appendUnique(removed, v)
+		}
+	}
+	if len(rest) > len(cur) || !equalValues(rest, cur[:len(rest)]) {
+		return nil, nil, false
+	}
+	return removed, cur[len(rest):], true
+}
+
+// equalSections reports whether two sections have the same type and
+// options (in the same order).
+func equalSections(a, b *section) bool {
+	if a.Type != b.Type || len(a.Options) != len(b.Options) {
+		return false
+	}
+	for i, opt := range a.Options {
+		other := b.Options[i]
+		if opt.Name != other.Name || opt.Type != other.Type || !equalValues(opt.Values, other.Values) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,232 @@
+package uci
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffConfigs(t *testing.T) {
+	assert := assert.New(t)
+
+	old, err := parse("test", `
+config system
+	option hostname 'old'
+	option timezone 'UTC'
+
+config timeserver 'ntp'
+	list server '0.pool.ntp.org'
+
+config led 'wifi'
+	option trigger 'phy0tpt'
+`)
+	assert.NoError(err)
+
+	cur, err := parse("test", `
+config system
+	option hostname 'new'
+
+config timeserver 'ntp'
+	list server '0.pool.ntp.org'
+	list server '1.pool.ntp.org'
+	option enabled '1'
+
+config led 'lan'
+	option trigger 'netdev'
+`)
+	assert.NoError(err)
+
+	assert.Equal([]Change{
+		{Type: SectionRemoved, Section: "wifi", SectionType: "led"},
+		{Type: OptionRemoved, Section: "@system[0]", SectionType: "system", Option: "timezone"},
+		{Type: OptionSet, Section: "@system[0]", SectionType: "system", Option: "hostname", Values: []string{"new"}},
+		{Type: OptionSet, Section: "ntp", SectionType: "timeserver", Option: "server", Values: []string{"0.pool.ntp.org", "1.pool.ntp.org"}},
+		{Type: OptionSet, Section: "ntp", SectionType: "timeserver", Option: "enabled", Values: []string{"1"}},
+		{Type: SectionAdded, Section: "lan", SectionType: "led"},
+		{Type: OptionSet, Section: "lan", SectionType: "led", Option: "trigger", Values: []string{"netdev"}},
+	}, diffConfigs(old, cur))
+
+	assert.Empty(diffConfigs(cur, cur))
+}
+
+func TestChangeString(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("section-added lan=interface", Change{Type: SectionAdded, Section: "lan", SectionType: "interface"}.String())
+	assert.Equal(`option-set lan.ipaddr=["10.0.0.1"]`, Change{Type: OptionSet, Section: "lan", Option: "ipaddr", Values: []string{"10.0.0.1"}}.String())
+	assert.Equal("option-removed lan.dns", Change{Type: OptionRemoved, Section: "lan", Option: "dns"}.String())
+	assert.Equal("section-retyped ssh=rule (was redirect)", Change{Type: SectionRetyped, Section: "ssh", SectionType: "rule", OldType: "redirect"}.String())
+	assert.Equal("section-moved wan=zone to 1", Change{Type: SectionMoved, Section: "wan", SectionType: "zone", Index: 1}.String())
+	assert.Equal(`list-added lan.network=["iot"]`, Change{Type: ListAdded, Section: "lan", Option: "network", Values: []string{"iot"}}.String())
+	assert.Equal(`list-removed lan.network=["guest"]`, Change{Type: ListRemoved, Section: "lan", Option: "network", Values: []string{"guest"}}.String())
+	assert.Equal("ChangeType(0)", ChangeType(0).String())
+}
+
+func TestChangeJSON(t *testing.T) {
+	b, err := json.Marshal(Change{Type: SectionMoved, Section: "wan", SectionType: "zone", Index: 0})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"type":6,"section":"wan","section_type":"zone","index":0}`, string(b))
+}
+
+func testSnapshot(t *testing.T, name, content string) *TreeSnapshot {
+	t.Helper()
+	cfg, err := parse(name, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &TreeSnapshot{configs: map[string]*config{name: cfg}}
+}
+
+func TestDiffConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	a := testSnapshot(t, "firewall", `
+config defaults
+	option input 'ACCEPT'
+
+config zone 'lan'
+	list network 'lan'
+	list network 'guest'
+
+config zone 'wan'
+	list network 'wan'
+
+config redirect 'ssh'
+	option src_dport '22'
+
+config rule
+	option name 'Allow-Ping'
+
+config rule
+	option name 'Allow-DHCP'
+`)
+	b := testSnapshot(t, "firewall", `
+config defaults
+	option input 'REJECT'
+
+config zone 'wan'
+	list network 'wan'
+	list network 'wan6'
+
+config zone 'lan'
+	list network 'lan'
+	list network 'iot'
+
+config rule 'ssh'
+	option src_dport '22'
+
+config rule
+	option name 'Allow-DHCP'
+`)
+
+	// by position
+	assert.Equal([]Change{
+		{Type: SectionRemoved, Section: "@rule[1]", SectionType: "rule"},
+		{Type: OptionSet, Section: "@defaults[0]", SectionType: "defaults", Option: "input", Values: []string{"REJECT"}},
+		{Type: SectionMoved, Section: "wan", SectionType: "zone", Index: 1},
+		{Type: ListAdded, Section: "wan", SectionType: "zone", Option: "network", Values: []string{"wan6"}},
+		{Type: ListRemoved, Section: "lan", SectionType: "zone", Option: "network", Values: []string{"guest"}},
+		{Type: ListAdded, Section: "lan", SectionType: "zone", Option: "network", Values: []string{"iot"}},
+		{Type: SectionRetyped, Section: "ssh", SectionType: "rule", OldType: "redirect"},
+		{Type: OptionSet, Section: "@rule[1]", SectionType: "rule", Option: "name", Values: []string{"Allow-DHCP"}},
+	}, DiffConfig(a, b, "firewall", DiffOptions{}))
+
+	// by content
+	assert.Equal([]Change{
+		{Type: SectionRemoved, Section: "@rule[0]", SectionType: "rule"},
+		{Type: OptionSet, Section: "@defaults[0]", SectionType: "defaults", Option: "input", Values: []string{"REJECT"}},
+		{Type: SectionMoved, Section: "wan", SectionType: "zone", Index: 1},
+		{Type: ListAdded, Section: "wan", SectionType: "zone", Option: "network", Values: []string{"wan6"}},
+		{Type: ListRemoved, Section: "lan", SectionType: "zone", Option: "network", Values: []string{"guest"}},
+		{Type: ListAdded, Section: "lan", SectionType: "zone", Option: "network", Values: []string{"iot"}},
+		{Type: SectionRetyped, Section: "ssh", SectionType: "rule", OldType: "redirect"},
+	}, DiffConfig(a, b, "firewall", DiffOptions{MatchContent: true}))
+
+	assert.Empty(DiffConfig(a, a, "firewall", DiffOptions{}))
+
+	// missing configs are empty
+	assert.Equal([]Change{
+		{Type: SectionRemoved, Section: "@defaults[0]", SectionType: "defaults"},
+		{Type: SectionRemoved, Section: "lan", SectionType: "zone"},
+		{Type: SectionRemoved, Section: "wan", SectionType: "zone"},
+		{Type: SectionRemoved, Section: "ssh", SectionType: "redirect"},
+		{Type: SectionRemoved, Section: "@rule[0]", SectionType: "rule"},
+		{Type: SectionRemoved, Section: "@rule[1]", SectionType: "rule"},
+	}, DiffConfig(a, &TreeSnapshot{}, "firewall", DiffOptions{}))
+}
+
+func TestDiffList(t *testing.T) {
+	assert := assert.New(t)
+
+	removed, added, ok := diffList([]string{"a", "b", "a", "c"}, []string{"c", "d"})
+	assert.True(ok)
+	assert.Equal([]string{"a", "b"}, removed)
+	assert.Equal([]string{"d"}, added)
+
+	// reordering needs a full replacement
+	_, _, ok = diffList([]string{"a", "b"}, []string{"b", "a"})
+	assert.False(ok)
+}
+
+func TestStableSections(t *testing.T) {
+	assert.Equal(t, []bool{true, false, false, true}, stableSections([]int{0, -1, 2, 1}))
+	assert.Equal(t, []bool{false, false, true}, stableSections([]int{2, 1, 0}))
+}
+
+func TestDiffTrees(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "system", "config system\n\toption hostname 'OpenWrt'\n")
+	writeTestConfig(t, dir, "network", "config interface 'lan'\n")
+
+	current := NewTree(dir)
+	desired := current.(Cloner).Clone()
+	assert.NoError(desired.SetType("system", "@system[0]", "hostname", TypeOption, "router"))
+
+	diffs, err := DiffTrees(current, desired, DiffOptions{}, "system", "network")
+	assert.NoError(err)
+	assert.Equal(map[string][]Change{
+		"system": {
+			{Type: OptionSet, Section: "@system[0]", SectionType: "system", Option: "hostname", Values: []string{"router"}},
+		},
+	}, diffs)
+
+	_, err = DiffTrees(current, desired, DiffOptions{}, "missing")
+	assert.Error(err)
+}
+
+func TestDiffTrees_loadedOnOneSide(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "system", "config system\n\toption hostname 'OpenWrt'\n")
+
+	current := NewTree(dir)
+	desired := NewTree(dir)
+	assert.NoError(desired.SetType("system", "@system[0]", "hostname", TypeOption, "router"))
+	assert.NoError(desired.AddSection("network", "lan", "interface"))
+
+	// neither config is loaded in current
+	diffs, err := DiffTrees(current, desired, DiffOptions{})
+	assert.NoError(err)
+	assert.Equal(map[string][]Change{
+		"system": {
+			{Type: OptionSet, Section: "@system[0]", SectionType: "system", Option: "hostname", Values: []string{"router"}},
+		},
+		"network": {
+			{Type: SectionAdded, Section: "lan", SectionType: "interface"},
+		},
+	}, diffs)
+
+	// and vice versa
+	diffs, err = DiffTrees(desired, NewTree(dir), DiffOptions{})
+	assert.NoError(err)
+	assert.Equal(map[string][]Change{
+		"system": {
+			{Type: OptionSet, Section: "@system[0]", SectionType: "system", Option: "hostname", Values: []string{"OpenWrt"}},
+		},
+		"network": {
+			{Type: SectionRemoved, Section: "lan", SectionType: "interface"},
+		},
+	}, diffs)
+}
@@ -0,0 +1,81 @@
+package uci
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// FileDiff describes the change Commit would apply to a config file.
+type FileDiff struct {
+	Config  string `json:"config"`
+	Path    string `json:"path"`    // file to be written (symlinks resolved)
+	Created bool   `json:"created"` // whether the file does not exist yet
+	Diff    string `json:"diff"`    // unified diff
+}
+
+// A DryRunner previews commits. Trees created by NewTree or
+// NewArchiveTree implement it, and so do their wrappers (see ReadOnly and
+// Fork), if the wrapped tree does.
+type DryRunner interface {
+	// DryRun reports the changes Commit would write to disk, without
+	// touching the file system. It returns a unified diff for each file
+	// whose content would change. If config names are given, only these
+	// configs are considered (see Commit). Hooks and validators are not
+	// run.
+	DryRun(configs ...string) ([]FileDiff, error)
+}
+
+var _ DryRunner = (*tree)(nil)
+
+func (t *tree) DryRun(configs ...string) ([]FileDiff, error) {
+	names, _, _, err := t.taintedConfigs(configs...)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	diffs := make([]FileDiff, 0, len(names))
+	for _, name := range names {
+		cfg, ok := t.configs[name]
+		if !ok {
+			continue
+		}
+
+		var buf bytes.Buffer
+		cfg.mu.RLock()
+		_, err = cfg.WriteTo(&buf)
+		cfg.mu.RUnlock()
+		if err != nil {
+			return nil, err
+		}
+
+		path := ArchivePrefix + name
+		if t.archive == nil {
+			path = resolveSymlink(filepath.Join(t.dir, name))
+		}
+		fromName := path
+		current, err := t.readFile(name)
+		if errors.Is(err, os.ErrNotExist) {
+			fromName = os.DevNull
+		} else if err != nil {
+			return nil, fmt.Errorf("dry-run: %w", err)
+		}
+
+		diff := unifiedDiff(fromName, path, string(current), buf.String())
+		if diff == "" {
+			continue
+		}
+		diffs = append(diffs, FileDiff{
+			Config:  name,
+			Path:    path,
+			Created: fromName == os.DevNull,
+			Diff:    diff,
+		})
+	}
+	return diffs, nil
+}
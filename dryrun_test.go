@@ -0,0 +1,69 @@
+package uci
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDryRun(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "network", "\nconfig interface 'lan'\n\toption proto 'static'\n\toption ipaddr '192.168.1.1'\n\n")
+	writeTestConfig(t, dir, "system", "\nconfig system\n\toption hostname 'OpenWrt'\n\n")
+
+	r := NewTree(dir)
+	require.NoError(t, r.SetType("network", "lan", "ipaddr", TypeOption, "10.0.0.1"))
+	require.NoError(t, r.AddSection("firewall", "wan", "zone"))
+
+	// tainted, but unchanged
+	require.NoError(t, r.SetType("system", "@system[0]", "hostname", TypeOption, "OpenWrt"))
+
+	diffs, err := r.(DryRunner).DryRun()
+	require.NoError(t, err)
+	assert.Equal([]FileDiff{{
+		Config:  "firewall",
+		Path:    filepath.Join(dir, "firewall"),
+		Created: true,
+		Diff: "--- /dev/null\n+++ " + filepath.Join(dir, "firewall") + "\n" +
+			"@@ -0,0 +1,3 @@\n+\n+config zone 'wan'\n+\n",
+	}, {
+		Config: "network",
+		Path:   filepath.Join(dir, "network"),
+		Diff: "--- " + filepath.Join(dir, "network") + "\n+++ " + filepath.Join(dir, "network") + "\n" +
+			"@@ -1,5 +1,5 @@\n \n config interface 'lan'\n \toption proto 'static'\n" +
+			"-\toption ipaddr '192.168.1.1'\n+\toption ipaddr '10.0.0.1'\n \n",
+	}}, diffs)
+
+	// nothing has been written
+	assert.NoFileExists(filepath.Join(dir, "firewall"))
+	body, err := os.ReadFile(filepath.Join(dir, "network"))
+	require.NoError(t, err)
+	assert.Contains(string(body), "192.168.1.1")
+
+	diffs, err = r.(DryRunner).DryRun("network")
+	require.NoError(t, err)
+	assert.Len(diffs, 1)
+
+	_, err = r.(DryRunner).DryRun("dhcp")
+	assert.ErrorAs(err, &ErrConfigNotLoaded{})
+}
+
+func TestDryRunner(t *testing.T) {
+	assert := assert.New(t)
+	r := NewTree(t.TempDir())
+
+	assert.Implements((*DryRunner)(nil), r)
+	assert.Implements((*DryRunner)(nil), ReadOnly(r))
+	assert.Implements((*DryRunner)(nil), r.(Cloner).Clone())
+
+	// forks of trees without dry-run support
+	f := &Fork{Tree: struct{ Tree }{r}}
+	var nsErr ErrNotSupported
+	_, err := f.DryRun()
+	assert.ErrorAs(err, &nsErr)
+	assert.Equal("DryRun", nsErr.Op)
+}
@@ -2,6 +2,7 @@ package uci
 
 import (
 	"fmt"
+	"strings"
 )
 
 // ErrConfigAlreadyLoaded is returned by LoadConfig, if the given config
@@ -14,6 +15,47 @@ func (err ErrConfigAlreadyLoaded) Error() string {
 	return fmt.Sprintf("%s already loaded", err.Name)
 }
 
+// ErrConfigNotLoaded is returned by Commit, if one of the given config
+// names is not loaded (or does not exist).
+type ErrConfigNotLoaded struct {
+	Name string
+}
+
+func (err ErrConfigNotLoaded) Error() string {
+	return fmt.Sprintf("%s not loaded", err.Name)
+}
+
+// ErrReadOnly is returned by all methods of a read-only tree (see
+// ReadOnly), which would modify a config.
+type ErrReadOnly struct {
+	Op string // name of the rejected method
+}
+
+func (err ErrReadOnly) Error() string {
+	return fmt.Sprintf("%s: tree is read-only", err.Op)
+}
+
+// ErrNotSupported is returned by wrappers (like Fork) and package-level
+// functions, if the underlying tree does not implement an optional
+// interface, such as HistoryKeeper.
+type ErrNotSupported struct {
+	Op string // name of the unsupported method
+}
+
+func (err ErrNotSupported) Error() string {
+	return fmt.Sprintf("%s: not supported by tree", err.Op)
+}
+
+// ErrMergeConflict is returned by Fork.Merge, if configs changed in the
+// fork have been modified in the original tree as well.
+type ErrMergeConflict struct {
+	Configs []string
+}
+
+func (err ErrMergeConflict) Error() string {
+	return fmt.Sprintf("merge conflict in %s", strings.Join(err.Configs, ", "))
+}
+
 // ErrUnknownOptionType is returned when trying to parse an invalid OptionType.
 type ErrUnknownOptionType struct {
 	Type string
@@ -56,3 +98,13 @@ type ErrSectionNotFound struct {
 func (err ErrSectionNotFound) Error() string {
 	return fmt.Sprintf("section %s not found", err.Section)
 }
+
+// ErrOptionNotFound is returned by the path-based methods of Tree (see
+// PathError), if an option does not exist.
+type ErrOptionNotFound struct {
+	Option string
+}
+
+func (err ErrOptionNotFound) Error() string {
+	return fmt.Sprintf("option %s not found", err.Option)
+}
@@ -0,0 +1,382 @@
+package uci
+
+import (
+	"context"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A Fork is an independent copy of a tree, created by Cloner.Clone. It can
+// be used like any other Tree (changes made to it do not affect the
+// original tree, and vice versa), e.g. to try out changes. Diff reports
+// how the fork differs from the original tree, and Merge transfers the
+// changes back to it.
+//
+// Note that committing the fork writes to the same files as committing
+// the original tree would. The original tree does not notice this.
+type Fork struct {
+	Tree
+
+	fork     *tree
+	origin   *tree
+	readOnly bool // see ReadOnly
+
+	mu   sync.Mutex
+	base map[string]forkState // configs of origin, when forked or merged
+	own  map[string]forkState // configs of fork, at the same time
+}
+
+// forkState records a config and its generation, to detect changes.
+type forkState struct {
+	cfg *config
+	gen uint64
+}
+
+// A Cloner creates forks. Trees created by NewTree implement it, and so
+// do their wrappers (see ReadOnly and Fork), if the wrapped tree does.
+type Cloner interface {
+	// Clone returns an independent copy of the tree, including all loaded
+	// configs, their pending changes, and the tree's settings (validators,
+	// hooks, etc.). Changes made to the clone can be inspected and
+	// transferred back to this tree with Fork.Diff and Fork.Merge.
+	Clone() *Fork
+}
+
+var _ Cloner = (*tree)(nil)
+
+func (t *tree) Clone() *Fork {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	cfgs := make([]*config, 0, len(t.configs))
+	for _, cfg := range t.configs {
+		cfgs = append(cfgs, cfg)
+	}
+	rlockConfigs(cfgs)
+	defer runlockConfigs(cfgs)
+
+	c := &tree{
+		dir:         t.dir,
+		configs:     make(map[string]*config, len(cfgs)),
+		preCommit:   append([]CommitHook(nil), t.preCommit...),
+		postCommit:  append([]CommitHook(nil), t.postCommit...),
+		history:     t.history,
+		schema:      t.schema,      // never modified
+		archive:     t.archive,     // never modified
+		archiveInfo: t.archiveInfo, // never modified
+	}
+	if t.fileModes != nil {
+		c.fileModes = make(map[string]os.FileMode, len(t.fileModes))
+		for name, mode := range t.fileModes {
+			c.fileModes[name] = mode
+		}
+	}
+	if t.validators != nil {
+		c.validators = make(map[string][]Validator, len(t.validators))
+		for name, v := range t.validators {
+			c.validators[name] = append([]Validator(nil), v...)
+		}
+	}
+
+	f := &Fork{
+		Tree:   c,
+		fork:   c,
+		origin: t,
+		base:   make(map[string]forkState, len(cfgs)),
+		own:    make(map[string]forkState, len(cfgs)),
+	}
+	for _, cfg := range cfgs {
+		cp := cfg.clone()
+		c.configs[cfg.Name] = cp
+		f.base[cfg.Name] = forkState{cfg, cfg.gen}
+		f.own[cfg.Name] = forkState{cp, cp.gen}
+	}
+	return f
+}
+
+// Diff compares the configs loaded in the fork or in the original tree,
+// and returns the changes needed to turn the original's version of each
+// config into the fork's version. Configs loaded on one side only are
+// compared to their on-disk version. Only configs with changes are
+// included in the result.
+func (f *Fork) Diff() (map[string][]Change, error) {
+	a, err := f.origin.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	b, err := f.fork.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	diffs := make(map[string][]Change)
+	for _, name := range appendUnique(a.Configs(), b.Configs()...) {
+		old, ok := a.configs[name]
+		if !ok {
+			if old, err = f.origin.committedConfig(name); err != nil {
+				return nil, err
+			}
+		}
+		cur, ok := b.configs[name]
+		if !ok {
+			if cur, err = f.fork.committedConfig(name); err != nil {
+				return nil, err
+			}
+		}
+		if changes := diffConfigs(old, cur); len(changes) > 0 {
+			diffs[name] = changes
+		}
+	}
+	return diffs, nil
+}
+
+// Validate runs the validators registered in the fork (see
+// ValidatorRegistrar) for all configs with pending changes, as Commit
+// would do.
+func (f *Fork) Validate() error {
+	c := f.fork
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	cfgs := make([]*config, 0, len(c.configs))
+	for _, cfg := range c.configs {
+		cfgs = append(cfgs, cfg)
+	}
+	rlockConfigs(cfgs)
+	defer runlockConfigs(cfgs)
+
+	var tainted []*config
+	for _, cfg := range cfgs {
+		if cfg.tainted {
+			tainted = append(tainted, cfg)
+		}
+	}
+	sort.Slice(tainted, func(i, j int) bool { return tainted[i].Name < tainted[j].Name })
+	return c.validate(tainted)
+}
+
+// Merge transfers the configs changed in the fork (since it was created,
+// or since the last merge) back to the original tree, replacing the
+// original's versions including their pending changes. Configs reverted
+// in the fork are reverted in the original as well. Nothing is written
+// to disk.
+//
+// If any of these configs has been changed (or reloaded) in the original
+// tree in the meantime, nothing is merged, and an ErrMergeConflict is
+// returned. Forks of read-only trees cannot be merged.
+func (f *Fork) Merge() error {
+	if f.readOnly {
+		return ErrReadOnly{Op: "Merge"}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	o, c := f.origin, f.fork
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	// collect the configs changed in the fork
+	var changed []string
+	for name := range f.own {
+		if _, ok := c.configs[name]; !ok {
+			changed = append(changed, name) // reverted
+		}
+	}
+	cfgs := make([]*config, 0, len(c.configs))
+	for _, cfg := range c.configs {
+		cfgs = append(cfgs, cfg)
+	}
+	gens := rlockConfigs(cfgs)
+	defer runlockConfigs(cfgs)
+	for i, cfg := range cfgs {
+		if st, ok := f.own[cfg.Name]; !ok || st.cfg != cfg || st.gen != gens[i] {
+			changed = append(changed, cfg.Name)
+		}
+	}
+	sort.Strings(changed)
+
+	var conflicts []string
+	for _, name := range changed {
+		cur, exists := o.configs[name]
+		if st, ok := f.base[name]; ok {
+			if !exists || cur != st.cfg || cur.gen != st.gen {
+				conflicts = append(conflicts, name)
+			}
+		} else if exists && cur.tainted {
+			conflicts = append(conflicts, name)
+		}
+	}
+	if len(conflicts) > 0 {
+		return ErrMergeConflict{Configs: conflicts}
+	}
+
+	for _, name := range changed {
+		cfg, ok := c.configs[name]
+		if !ok {
+			delete(o.configs, name)
+			delete(f.base, name)
+			delete(f.own, name)
+			continue
+		}
+		cp := cfg.clone()
+		o.setConfig(cp)
+		f.base[name] = forkState{cp, cp.gen}
+		f.own[name] = forkState{cfg, cfg.gen}
+	}
+	return nil
+}
+
+// Watch implements Watcher, if the forked tree does.
+func (f *Fork) Watch(ctx context.Context) (<-chan WatchEvent, error) {
+	return watchTree(ctx, f.Tree)
+}
+
+func (f *Fork) SetHistory(h *History) {
+	if hk, err := optional[HistoryKeeper](f.Tree, "SetHistory"); err == nil {
+		hk.SetHistory(h)
+	}
+}
+
+func (f *Fork) CommitWithMessage(message string, configs ...string) error {
+	hk, err := optional[HistoryKeeper](f.Tree, "CommitWithMessage")
+	if err != nil {
+		return err
+	}
+	return hk.CommitWithMessage(message, configs...)
+}
+
+func (f *Fork) RestoreVersion(config string, id int) error {
+	hk, err := optional[HistoryKeeper](f.Tree, "RestoreVersion")
+	if err != nil {
+		return err
+	}
+	return hk.RestoreVersion(config, id)
+}
+
+func (f *Fork) Backup(w io.Writer, configs ...string) error {
+	a, err := optional[Archiver](f.Tree, "Backup")
+	if err != nil {
+		return err
+	}
+	return a.Backup(w, configs...)
+}
+
+func (f *Fork) Restore(r io.Reader) error {
+	a, err := optional[Archiver](f.Tree, "Restore")
+	if err != nil {
+		return err
+	}
+	return a.Restore(r)
+}
+
+func (f *Fork) GetPath(p Path) ([]string, error) {
+	pa, err := optional[PathAccessor](f.Tree, "GetPath")
+	if err != nil {
+		return nil, err
+	}
+	return pa.GetPath(p)
+}
+
+func (f *Fork) SetPath(p Path, values ...string) error {
+	pa, err := optional[PathAccessor](f.Tree, "SetPath")
+	if err != nil {
+		return err
+	}
+	return pa.SetPath(p, values...)
+}
+
+func (f *Fork) AddPath(p Path, values ...string) error {
+	pa, err := optional[PathAccessor](f.Tree, "AddPath")
+	if err != nil {
+		return err
+	}
+	return pa.AddPath(p, values...)
+}
+
+func (f *Fork) DelPath(p Path) error {
+	pa, err := optional[PathAccessor](f.Tree, "DelPath")
+	if err != nil {
+		return err
+	}
+	return pa.DelPath(p)
+}
+
+func (f *Fork) AddPreCommitHook(h CommitHook) {
+	if hr, err := optional[HookRegistrar](f.Tree, "AddPreCommitHook"); err == nil {
+		hr.AddPreCommitHook(h)
+	}
+}
+
+func (f *Fork) AddPostCommitHook(h CommitHook) {
+	if hr, err := optional[HookRegistrar](f.Tree, "AddPostCommitHook"); err == nil {
+		hr.AddPostCommitHook(h)
+	}
+}
+
+func (f *Fork) Apply(timeout time.Duration, clock Clock) (*ApplySession, error) {
+	a, err := optional[Applier](f.Tree, "Apply")
+	if err != nil {
+		return nil, err
+	}
+	return a.Apply(timeout, clock)
+}
+
+func (f *Fork) SetFileMode(config string, mode os.FileMode) {
+	if fm, err := optional[FileModeSetter](f.Tree, "SetFileMode"); err == nil {
+		fm.SetFileMode(config, mode)
+	}
+}
+
+func (f *Fork) AddValidator(config string, v Validator) {
+	if vr, err := optional[ValidatorRegistrar](f.Tree, "AddValidator"); err == nil {
+		vr.AddValidator(config, v)
+	}
+}
+
+func (f *Fork) DryRun(configs ...string) ([]FileDiff, error) {
+	dr, err := optional[DryRunner](f.Tree, "DryRun")
+	if err != nil {
+		return nil, err
+	}
+	return dr.DryRun(configs...)
+}
+
+// Clone returns a fork of the fork. It returns nil, if the forked tree
+// does not implement Cloner.
+func (f *Fork) Clone() *Fork {
+	c, err := optional[Cloner](f.Tree, "Clone")
+	if err != nil {
+		return nil
+	}
+	return c.Clone()
+}
+
+func (f *Fork) ExportBatch(w io.Writer, configs ...string) error {
+	b, err := optional[Batcher](f.Tree, "ExportBatch")
+	if err != nil {
+		return err
+	}
+	return b.ExportBatch(w, configs...)
+}
+
+func (f *Fork) Batch(r io.Reader) error {
+	b, err := optional[Batcher](f.Tree, "Batch")
+	if err != nil {
+		return err
+	}
+	return b.Batch(r)
+}
+
+func (f *Fork) Import(config string, r io.Reader, mode ImportMode) error {
+	i, err := optional[Importer](f.Tree, "Import")
+	if err != nil {
+		return err
+	}
+	return i.Import(config, r, mode)
+}
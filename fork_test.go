@@ -0,0 +1,127 @@
+package uci
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClone(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "network", "config interface 'lan'\n\toption proto 'static'\n")
+	writeTestConfig(t, dir, "system", "config system\n\toption hostname 'OpenWrt'\n")
+
+	r := NewTree(dir)
+	require.NoError(t, r.SetType("network", "lan", "ipaddr", TypeOption, "192.168.1.1"))
+
+	f := r.(Cloner).Clone()
+	ipaddr, ok := f.GetLast("network", "lan", "ipaddr")
+	assert.True(ok)
+	assert.Equal("192.168.1.1", ipaddr)
+
+	// the fork is independent of the original
+	require.NoError(t, f.SetType("network", "lan", "proto", TypeOption, "dhcp"))
+	require.NoError(t, f.SetType("system", "@system[0]", "hostname", TypeOption, "fork"))
+	require.NoError(t, r.SetType("network", "lan", "netmask", TypeOption, "255.255.255.0"))
+
+	proto, _ := r.GetLast("network", "lan", "proto")
+	assert.Equal("static", proto)
+	hostname, _ := r.GetLast("system", "@system[0]", "hostname")
+	assert.Equal("OpenWrt", hostname)
+	_, ok = f.GetLast("network", "lan", "netmask")
+	assert.False(ok)
+
+	diffs, err := f.Diff()
+	require.NoError(t, err)
+	assert.Equal(map[string][]Change{
+		"network": {
+			{Type: OptionRemoved, Section: "lan", SectionType: "interface", Option: "netmask"},
+			{Type: OptionSet, Section: "lan", SectionType: "interface", Option: "proto", Values: []string{"dhcp"}},
+		},
+		"system": {
+			{Type: OptionSet, Section: "@system[0]", SectionType: "system", Option: "hostname", Values: []string{"fork"}},
+		},
+	}, diffs)
+
+	// network has been changed on both sides
+	var conflict ErrMergeConflict
+	require.ErrorAs(t, f.Merge(), &conflict)
+	assert.Equal([]string{"network"}, conflict.Configs)
+	assert.EqualError(conflict, "merge conflict in network")
+	hostname, _ = r.GetLast("system", "@system[0]", "hostname")
+	assert.Equal("OpenWrt", hostname)
+
+	// try again with a fresh fork
+	f = r.(Cloner).Clone()
+	require.NoError(t, f.SetType("network", "lan", "proto", TypeOption, "dhcp"))
+	require.NoError(t, f.SetType("system", "@system[0]", "hostname", TypeOption, "fork"))
+	require.NoError(t, f.Merge())
+
+	proto, _ = r.GetLast("network", "lan", "proto")
+	assert.Equal("dhcp", proto)
+	netmask, _ := r.GetLast("network", "lan", "netmask")
+	assert.Equal("255.255.255.0", netmask)
+	hostname, _ = r.GetLast("system", "@system[0]", "hostname")
+	assert.Equal("fork", hostname)
+	diffs, err = f.Diff()
+	require.NoError(t, err)
+	assert.Empty(diffs)
+
+	// subsequent merges only transfer new changes
+	require.NoError(t, r.SetType("system", "@system[0]", "hostname", TypeOption, "original"))
+	f.Revert("network")
+	require.NoError(t, f.Merge())
+	_, ok = r.GetLast("network", "lan", "netmask")
+	assert.False(ok, "network should have been reverted")
+	hostname, _ = r.GetLast("system", "@system[0]", "hostname")
+	assert.Equal("original", hostname)
+}
+
+func TestClone_validate(t *testing.T) {
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "system", "config system\n\toption hostname 'OpenWrt'\n")
+
+	r := NewTree(dir)
+	r.(ValidatorRegistrar).AddValidator("system", func(v ConfigView) error {
+		var verr ValidationError
+		for _, name := range v.Sections() {
+			if values, _ := v.Get(name, "hostname"); len(values) == 0 || values[0] == "" {
+				verr.Add(name, "hostname", "must not be empty")
+			}
+		}
+		return verr.Err()
+	})
+
+	f := r.(Cloner).Clone()
+	assert.NoError(t, f.Validate())
+	require.NoError(t, f.SetType("system", "@system[0]", "hostname", TypeOption, ""))
+	assert.Error(t, f.Validate())
+}
+
+func TestClone_readOnly(t *testing.T) {
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "system", "config system\n\toption hostname 'OpenWrt'\n")
+
+	f := NewReadOnlyTree(dir).(Cloner).Clone()
+	hostname, ok := f.GetLast("system", "@system[0]", "hostname")
+	assert.True(t, ok)
+	assert.Equal(t, "OpenWrt", hostname)
+	assert.ErrorIs(t, f.SetType("system", "@system[0]", "hostname", TypeOption, "foo"), ErrReadOnly{Op: "SetType"})
+	assert.ErrorIs(t, f.Merge(), ErrReadOnly{Op: "Merge"})
+}
+
+func TestCloner(t *testing.T) {
+	assert := assert.New(t)
+	r := NewTree(t.TempDir())
+
+	assert.Implements((*Cloner)(nil), r)
+	assert.Implements((*Cloner)(nil), ReadOnly(r))
+	assert.Implements((*Cloner)(nil), r.(Cloner).Clone())
+	assert.NotNil(r.(Cloner).Clone().Clone())
+
+	// trees without clone support
+	assert.Nil((&Fork{Tree: struct{ Tree }{r}}).Clone())
+	assert.Nil(ReadOnly(struct{ Tree }{r}).(Cloner).Clone())
+}
@@ -0,0 +1,268 @@
+package uci
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoHistory is returned by HistoryKeeper.RestoreVersion, if no
+// History has been configured with HistoryKeeper.SetHistory.
+var ErrNoHistory = errors.New("history is not enabled")
+
+// ErrVersionNotFound is returned when accessing a version, which does
+// not exist (anymore).
+type ErrVersionNotFound struct {
+	Config string
+	ID     int
+}
+
+func (err ErrVersionNotFound) Error() string {
+	return fmt.Sprintf("version %d of %s not found", err.ID, err.Config)
+}
+
+// Version describes a config file version stored in a History.
+type Version struct {
+	ID      int       `json:"id"`
+	Time    time.Time `json:"time"`
+	Message string    `json:"message,omitempty"`
+}
+
+// History keeps previous versions of committed config files. Each config
+// has its own subdirectory in the history directory, containing a file
+// "$id" with the content and "$id.json" with the metadata for each
+// version.
+//
+// The history directory should live outside the tree's directory (e.g.
+// in /etc/uci-history), otherwise the subdirectories might be mistaken
+// for configs.
+type History struct {
+	dir  string
+	keep int
+
+	now func() time.Time // replaced in tests
+
+	mu sync.Mutex // serializes record
+}
+
+// NewHistory creates a history, which stores the current version and up
+// to keep previous versions of each config in dir (all versions, if keep
+// is 0). The directory is created on demand.
+func NewHistory(dir string, keep int) *History {
+	return &History{
+		dir:  dir,
+		keep: keep,
+		now:  time.Now,
+	}
+}
+
+// Versions lists the stored versions of a config, oldest first.
+func (h *History) Versions(config string) ([]Version, error) {
+	entries, err := os.ReadDir(filepath.Join(h.dir, config))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("history: %w", err)
+	}
+
+	var versions []Version
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		body, err := os.ReadFile(filepath.Join(h.dir, config, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("history: %w", err)
+		}
+		var v Version
+		if err = json.Unmarshal(body, &v); err != nil {
+			return nil, fmt.Errorf("history: invalid metadata in %s: %w", e.Name(), err)
+		}
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].ID < versions[j].ID })
+	return versions, nil
+}
+
+// Read returns the content of a stored version.
+func (h *History) Read(config string, id int) ([]byte, error) {
+	body, err := os.ReadFile(h.path(config, id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrVersionNotFound{Config: config, ID: id}
+	} else if err != nil {
+		return nil, fmt.Errorf("history: %w", err)
+	}
+	return body, nil
+}
+
+// Diff returns a unified diff between two stored versions of a config.
+func (h *History) Diff(config string, from, to int) (string, error) {
+	a, err := h.Read(config, from)
+	if err != nil {
+		return "", err
+	}
+	b, err := h.Read(config, to)
+	if err != nil {
+		return "", err
+	}
+	return unifiedDiff(
+		fmt.Sprintf("%s@%d", config, from),
+		fmt.Sprintf("%s@%d", config, to),
+		string(a), string(b)), nil
+}
+
+func (h *History) path(config string, id int) string {
+	return filepath.Join(h.dir, config, strconv.Itoa(id))
+}
+
+// record stores a new version of a config, and prunes the oldest
+// versions exceeding the limit. The new version does not count against
+// the limit.
+func (h *History) record(config string, body []byte, message string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	versions, err := h.Versions(config)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Join(h.dir, config), 0o700); err != nil {
+		return fmt.Errorf("history: %w", err)
+	}
+
+	v := Version{ID: 1, Time: h.now(), Message: message}
+	if n := len(versions); n > 0 {
+		v.ID = versions[n-1].ID + 1
+	}
+	meta, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("history: %w", err)
+	}
+	if err = os.WriteFile(h.path(config, v.ID), body, 0o600); err != nil {
+		return fmt.Errorf("history: %w", err)
+	}
+	if err = os.WriteFile(h.path(config, v.ID)+".json", meta, 0o600); err != nil {
+		return fmt.Errorf("history: %w", err)
+	}
+
+	versions = append(versions, v)
+	for h.keep > 0 && len(versions) > h.keep+1 {
+		old := h.path(config, versions[0].ID)
+		if err = os.Remove(old + ".json"); err != nil {
+			return fmt.Errorf("history: %w", err)
+		}
+		_ = os.Remove(old)
+		versions = versions[1:]
+	}
+	return nil
+}
+
+// A HistoryKeeper keeps previous versions of committed files in a
+// History. Trees created by NewTree implement it, and so do their
+// wrappers (see ReadOnly and Fork), if the wrapped tree does.
+type HistoryKeeper interface {
+	// SetHistory enables keeping previous versions of committed files.
+	// Pass nil to disable it again.
+	SetHistory(h *History)
+
+	// CommitWithMessage works like Tree.Commit, but attaches a message
+	// to the versions recorded in the history (see SetHistory).
+	CommitWithMessage(message string, configs ...string) error
+
+	// RestoreVersion replaces a config in memory with a version from the
+	// history. The restored content becomes a pending change, which needs
+	// to be committed. It returns ErrNoHistory, if no history is set.
+	RestoreVersion(config string, id int) error
+}
+
+var _ HistoryKeeper = (*tree)(nil)
+
+func (t *tree) SetHistory(h *History) {
+	t.mu.Lock()
+	t.history = h
+	t.mu.Unlock()
+}
+
+func (t *tree) CommitWithMessage(message string, configs ...string) error {
+	names, pre, post, err := t.taintedConfigs(configs...)
+	if err != nil {
+		return err
+	}
+	_, err = t.commitWithHooks(names, message, pre, post)
+	return err
+}
+
+func (t *tree) RestoreVersion(name string, id int) error {
+	t.mu.RLock()
+	h := t.history
+	t.mu.RUnlock()
+
+	if h == nil {
+		return ErrNoHistory
+	}
+	body, err := h.Read(name, id)
+	if err != nil {
+		return err
+	}
+	cfg, err := parse(name, string(body))
+	if err != nil {
+		return fmt.Errorf("parse: %w", err)
+	}
+	base, err := t.committedConfig(name)
+	if err != nil {
+		return err
+	}
+
+	cfg.tainted = !cfg.equal(base)
+
+	t.mu.Lock()
+	t.setConfig(cfg)
+	t.mu.Unlock()
+	return nil
+}
+
+// historyBaseline returns the current on-disk content of a config, if
+// it needs to be recorded before the config is overwritten for the first
+// time. Its call must be guarded by locking the tree's mutex (at least
+// for reading).
+func (t *tree) historyBaseline(name string) []byte {
+	if t.history == nil {
+		return nil
+	}
+	if versions, err := t.history.Versions(name); err != nil || len(versions) > 0 {
+		return nil
+	}
+	body, err := t.readFile(name)
+	if err != nil {
+		return nil
+	}
+	return body
+}
+
+// recordHistory stores the baseline (if any) and the committed content
+// of a config. Its call must be guarded by locking the tree's mutex and
+// the config (at least for reading).
+func (t *tree) recordHistory(cfg *config, baseline []byte, message string) error {
+	if t.history == nil {
+		return nil
+	}
+	if baseline != nil {
+		if err := t.history.record(cfg.Name, baseline, ""); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	if _, err := cfg.WriteTo(&buf); err != nil {
+		return err
+	}
+	return t.history.record(cfg.Name, buf.Bytes(), message)
+}
@@ -0,0 +1,126 @@
+package uci
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	confDir := filepath.Join(dir, "config")
+	histDir := filepath.Join(dir, "history")
+	require.NoError(t, os.Mkdir(confDir, 0o755))
+	writeTestConfig(t, confDir, "system", "\nconfig system\n\toption hostname 'v0'\n\n")
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	h := NewHistory(histDir, 3)
+	h.now = func() time.Time {
+		now = now.Add(time.Minute)
+		return now
+	}
+
+	r := NewTree(confDir)
+	hk := r.(HistoryKeeper)
+	assert.ErrorIs(hk.RestoreVersion("system", 1), ErrNoHistory)
+	hk.SetHistory(h)
+
+	for _, hostname := range []string{"v1", "v2", "v3", "v4"} {
+		require.NoError(t, r.SetType("system", "@system[0]", "hostname", TypeOption, hostname))
+		require.NoError(t, hk.CommitWithMessage("set hostname to "+hostname))
+
+		if hostname == "v3" {
+			// the current version and the 3 previous ones (including
+			// the baseline v0) are kept
+			versions, err := h.Versions("system")
+			require.NoError(t, err)
+			assert.Len(versions, 4)
+			assert.Equal(1, versions[0].ID)
+		}
+	}
+
+	// baseline (v0) has been pruned
+	versions, err := h.Versions("system")
+	require.NoError(t, err)
+	assert.Equal([]Version{
+		{ID: 2, Time: time.Date(2024, 5, 1, 12, 2, 0, 0, time.UTC), Message: "set hostname to v1"},
+		{ID: 3, Time: time.Date(2024, 5, 1, 12, 3, 0, 0, time.UTC), Message: "set hostname to v2"},
+		{ID: 4, Time: time.Date(2024, 5, 1, 12, 4, 0, 0, time.UTC), Message: "set hostname to v3"},
+		{ID: 5, Time: time.Date(2024, 5, 1, 12, 5, 0, 0, time.UTC), Message: "set hostname to v4"},
+	}, versions)
+
+	_, err = h.Read("system", 1)
+	assert.ErrorAs(err, &ErrVersionNotFound{})
+
+	diff, err := h.Diff("system", 2, 4)
+	require.NoError(t, err)
+	assert.Equal("--- system@2\n+++ system@4\n@@ -1,4 +1,4 @@\n \n config system\n"+
+		"-\toption hostname 'v1'\n+\toption hostname 'v3'\n \n", diff)
+
+	// restore as pending change
+	require.NoError(t, hk.RestoreVersion("system", 2))
+	value, _ := r.GetLast("system", "@system[0]", "hostname")
+	assert.Equal("v1", value)
+	assert.True(r.(*tree).configs["system"].tainted)
+
+	// restoring the current version is no change
+	require.NoError(t, hk.RestoreVersion("system", 5))
+	assert.False(r.(*tree).configs["system"].tainted)
+
+	assert.ErrorAs(hk.RestoreVersion("system", 42), &ErrVersionNotFound{})
+
+	versions, err = h.Versions("nonexistent")
+	assert.NoError(err)
+	assert.Empty(versions)
+}
+
+func TestHistory_baseline(t *testing.T) {
+	assert := assert.New(t)
+	confDir := t.TempDir()
+	writeTestConfig(t, confDir, "system", "\nconfig system\n\toption hostname 'v0'\n\n")
+
+	h := NewHistory(filepath.Join(t.TempDir(), "history"), 0)
+	r := NewTree(confDir)
+	r.(HistoryKeeper).SetHistory(h)
+
+	require.NoError(t, r.SetType("system", "@system[0]", "hostname", TypeOption, "v1"))
+	require.NoError(t, r.AddSection("network", "lan", "interface"))
+	require.NoError(t, r.Commit())
+
+	versions, err := h.Versions("system")
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	assert.Equal("", versions[0].Message)
+
+	body, err := h.Read("system", 1)
+	require.NoError(t, err)
+	assert.Equal("\nconfig system\n\toption hostname 'v0'\n\n", string(body))
+
+	// new files have no baseline
+	versions, err = h.Versions("network")
+	require.NoError(t, err)
+	assert.Len(versions, 1)
+}
+
+func TestHistoryKeeper(t *testing.T) {
+	assert := assert.New(t)
+	r := NewTree(t.TempDir())
+
+	assert.Implements((*HistoryKeeper)(nil), r)
+	assert.Implements((*HistoryKeeper)(nil), ReadOnly(r))
+	assert.Implements((*HistoryKeeper)(nil), r.(Cloner).Clone())
+
+	// forks of trees without history support
+	f := &Fork{Tree: struct{ Tree }{r}}
+	f.SetHistory(nil) // no-op
+	var nsErr ErrNotSupported
+	assert.ErrorAs(f.CommitWithMessage("msg"), &nsErr)
+	assert.EqualError(nsErr, "CommitWithMessage: not supported by tree")
+	assert.ErrorAs(f.RestoreVersion("system", 1), &nsErr)
+	assert.Equal("RestoreVersion", nsErr.Op)
+}
@@ -0,0 +1,101 @@
+package uci
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// A CommitHook is called by Tree.Commit with the names of the configs
+// being committed.
+type CommitHook func(configs []string) error
+
+// A HookRegistrar runs hooks when committing configs. Trees created by
+// NewTree implement it, and so do their wrappers (see ReadOnly and Fork),
+// if the wrapped tree does.
+type HookRegistrar interface {
+	// AddPreCommitHook registers a hook to run before Commit writes any
+	// files. Hooks are called in the order of registration.
+	AddPreCommitHook(h CommitHook)
+
+	// AddPostCommitHook registers a hook to run after Commit has written
+	// the files, e.g. to reload services (see ReloadHook). Hooks are
+	// called in the order of registration.
+	AddPostCommitHook(h CommitHook)
+}
+
+var _ HookRegistrar = (*tree)(nil)
+
+func (t *tree) AddPreCommitHook(h CommitHook) {
+	t.mu.Lock()
+	t.preCommit = append(t.preCommit, h)
+	t.mu.Unlock()
+}
+
+func (t *tree) AddPostCommitHook(h CommitHook) {
+	t.mu.Lock()
+	t.postCommit = append(t.postCommit, h)
+	t.mu.Unlock()
+}
+
+// runHooks calls each hook in order, and stops at the first error. It
+// must not be called while holding the tree's lock, since hooks may
+// want to access the tree.
+func runHooks(hooks []CommitHook, configs []string) error {
+	for _, h := range hooks {
+		if err := h(configs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// taintedConfigs returns the sorted names of all configs with pending
+// changes, along with a copy of the registered commit hooks. If names
+// are given, the result is limited to these configs, and each of them
+// must be loaded.
+func (t *tree) taintedConfigs(names ...string) (tainted []string, pre, post []CommitHook, err error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if len(names) == 0 {
+		for name := range t.configs {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		cfg, ok := t.configs[name]
+		if !ok {
+			return nil, nil, nil, ErrConfigNotLoaded{Name: name}
+		}
+		cfg.mu.RLock()
+		if cfg.tainted {
+			tainted = appendUnique(tainted, name)
+		}
+		cfg.mu.RUnlock()
+	}
+	sort.Strings(tainted)
+	pre = append(pre, t.preCommit...)
+	post = append(post, t.postCommit...)
+	return tainted, pre, post, nil
+}
+
+// commitWithHooks runs the pre-commit hooks, writes the given configs,
+// and then runs the post-commit hooks for the configs actually written.
+// It returns the names of the written configs.
+func (t *tree) commitWithHooks(names []string, message string, pre, post []CommitHook) ([]string, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	if err := runHooks(pre, names); err != nil {
+		return nil, fmt.Errorf("pre-commit hook: %w", err)
+	}
+
+	committed, err := t.commit(names, message)
+	if len(committed) > 0 {
+		if herr := runHooks(post, committed); herr != nil {
+			err = errors.Join(err, fmt.Errorf("post-commit hook: %w", herr))
+		}
+	}
+	return committed, err
+}
@@ -0,0 +1,84 @@
+package uci
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommitHooks(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	r := NewTree(dir)
+
+	var pre, post [][]string
+	veto := errors.New("vetoed") //nolint:goerr113
+	r.(HookRegistrar).AddPreCommitHook(func(configs []string) error {
+		pre = append(pre, configs)
+		if len(configs) > 1 {
+			return veto
+		}
+		return nil
+	})
+	r.(HookRegistrar).AddPostCommitHook(func(configs []string) error {
+		post = append(post, configs)
+		// hooks may access the tree
+		_, ok := r.Get(configs[0], "a", "b")
+		assert.True(ok)
+		return nil
+	})
+
+	// nothing to commit, no hooks called
+	assert.NoError(r.Commit())
+	assert.Empty(pre)
+
+	assert.NoError(r.AddSection("foo", "a", "section"))
+	assert.NoError(r.AddSection("bar", "a", "section"))
+
+	// vetoed commit
+	err := r.Commit()
+	assert.ErrorIs(err, veto)
+	assert.EqualError(err, "pre-commit hook: vetoed")
+	assert.Equal([][]string{{"bar", "foo"}}, pre)
+	assert.Empty(post)
+	_, err = os.Stat(filepath.Join(dir, "foo"))
+	assert.ErrorIs(err, os.ErrNotExist)
+
+	r.Revert("bar")
+	assert.NoError(r.Commit())
+	assert.Equal([][]string{{"bar", "foo"}, {"foo"}}, pre)
+	assert.Equal([][]string{{"foo"}}, post)
+	_, err = os.Stat(filepath.Join(dir, "foo"))
+	assert.NoError(err)
+}
+
+func TestCommitHooks_postError(t *testing.T) {
+	assert := assert.New(t)
+	r := NewTree(t.TempDir())
+	r.(HookRegistrar).AddPostCommitHook(func([]string) error {
+		return errors.New("reload failed") //nolint:goerr113
+	})
+
+	assert.NoError(r.AddSection("foo", "a", "section"))
+	assert.EqualError(r.Commit(), "post-commit hook: reload failed")
+
+	// the commit itself succeeded
+	assert.False(r.(*tree).configs["foo"].tainted)
+}
+
+func TestHookRegistrar(t *testing.T) {
+	assert := assert.New(t)
+	r := NewTree(t.TempDir())
+
+	assert.Implements((*HookRegistrar)(nil), r)
+	assert.Implements((*HookRegistrar)(nil), ReadOnly(r))
+	assert.Implements((*HookRegistrar)(nil), r.(Cloner).Clone())
+
+	// forks of trees without hook support
+	f := &Fork{Tree: struct{ Tree }{r}}
+	f.AddPreCommitHook(func([]string) error { return nil })  // no-op
+	f.AddPostCommitHook(func([]string) error { return nil }) // no-op
+}
@@ -0,0 +1,102 @@
+package uci
+
+import (
+	"fmt"
+	"io"
+)
+
+// ImportMode controls how Importer.Import combines a snippet with an
+// existing config.
+type ImportMode int
+
+const (
+	// ImportMerge merges the snippet into the config, like "uci import
+	// -m" does: named sections missing in the config are added, existing
+	// ones are retyped (if necessary) and get the snippet's options. An
+	// option replaces an existing option or list, while list values are
+	// appended to an existing list (or option), unless already present.
+	// Unnamed sections are always added.
+	ImportMerge ImportMode = iota
+
+	// ImportMergeReplaceLists works like ImportMerge, but a list given in
+	// the snippet replaces an existing list (or option).
+	ImportMergeReplaceLists
+
+	// ImportReplace replaces the config with the snippet, like "uci
+	// import" does.
+	ImportReplace
+)
+
+// An Importer merges config snippets into configs. Trees created by
+// NewTree implement it, and so do their wrappers (see ReadOnly and Fork),
+// if the wrapped tree does.
+type Importer interface {
+	// Import reads a config snippet in UCI syntax from r, and combines it
+	// with the given config according to mode (see ImportMode). A config
+	// missing on disk is created. The changes are applied at once, like
+	// Tree.Update does, and nothing is changed, if the snippet is invalid.
+	Import(config string, r io.Reader, mode ImportMode) error
+}
+
+var _ Importer = (*tree)(nil)
+
+func (t *tree) Import(config string, r io.Reader, mode ImportMode) error {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("import: %w", err)
+	}
+	src, err := parse(config, string(body))
+	if err != nil {
+		return fmt.Errorf("import: %s: %w", config, err)
+	}
+
+	return t.update(func(x *tx) error {
+		if err := x.t.schema.checkImport(src); err != nil {
+			return err
+		}
+		if mode == ImportReplace {
+			x.configs[config] = src
+			x.dirty[config] = true
+			return nil
+		}
+		if len(src.Sections) == 0 {
+			return nil
+		}
+		cfg, err := x.modify(config, true)
+		if err != nil {
+			return fmt.Errorf("ensureConfigLoaded: %w", err)
+		}
+		cfg.importMerge(src, mode == ImportMergeReplaceLists)
+		x.dirty[config] = true
+		return nil
+	})
+}
+
+// importMerge merges the sections of src into c, see ImportMerge. Unlike
+// Merge (used by the parser), it matches sections by name only, retypes
+// them, and replaces options. The sections of src are taken over, src
+// must not be used afterwards.
+func (c *config) importMerge(src *config, replaceLists bool) {
+	for _, s := range src.Sections {
+		sec := c.getNamed(s.Name)
+		if s.Name == "" || sec == nil {
+			c.Add(s)
+			continue
+		}
+
+		sec.Type = s.Type
+		for _, o := range s.Options {
+			cur := sec.Get(o.Name)
+			switch {
+			case cur == nil:
+				sec.Add(o)
+			case o.Type == TypeList && !replaceLists:
+				cur.Type = TypeList
+				cur.MergeValues(o.Values...)
+			default:
+				cur.Type = o.Type
+				cur.SetValues(o.Values...)
+			}
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package uci
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const importTestConfig = `
+config interface 'lan'
+	option proto 'static'
+	option ipaddr '192.168.1.1'
+	list dns '8.8.8.8'
+
+config rule
+	option name 'Allow-Ping'
+`
+
+const importTestSnippet = `
+config interface 'lan'
+	option ipaddr '10.0.0.1'
+	list dns '1.1.1.1'
+	list dns '9.9.9.9'
+
+config interface 'guest'
+	option proto 'dhcp'
+
+config rule
+	option name 'Allow-SSH'
+`
+
+func TestImport(t *testing.T) {
+	for _, tc := range []struct {
+		mode     ImportMode
+		expected string
+	}{
+		{ImportMerge, `
+config interface 'lan'
+	option proto 'static'
+	option ipaddr '10.0.0.1'
+	list dns '8.8.8.8'
+	list dns '1.1.1.1'
+	list dns '9.9.9.9'
+
+config rule
+	option name 'Allow-Ping'
+
+config interface 'guest'
+	option proto 'dhcp'
+
+config rule
+	option name 'Allow-SSH'
+
+`},
+		{ImportMergeReplaceLists, `
+config interface 'lan'
+	option proto 'static'
+	option ipaddr '10.0.0.1'
+	list dns '1.1.1.1'
+	list dns '9.9.9.9'
+
+config rule
+	option name 'Allow-Ping'
+
+config interface 'guest'
+	option proto 'dhcp'
+
+config rule
+	option name 'Allow-SSH'
+
+`},
+		{ImportReplace, `
+config interface 'lan'
+	option ipaddr '10.0.0.1'
+	list dns '1.1.1.1'
+	list dns '9.9.9.9'
+
+config interface 'guest'
+	option proto 'dhcp'
+
+config rule
+	option name 'Allow-SSH'
+
+`},
+	} {
+		dir := t.TempDir()
+		writeTestConfig(t, dir, "network", importTestConfig)
+		r := NewTree(dir)
+		require.NoError(t, r.(Importer).Import("network", strings.NewReader(importTestSnippet), tc.mode))
+		require.NoError(t, r.Commit())
+		content, err := os.ReadFile(filepath.Join(dir, "network"))
+		require.NoError(t, err)
+		assert.Equal(t, tc.expected, string(content), tc.mode)
+	}
+}
+
+func TestImport_lists(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "network", "config interface 'lan'\n\tlist dns 'a'\n\tlist dns 'b'\n\toption ifname 'eth0'\n")
+	r := NewTree(dir)
+
+	snippet := "config interface 'lan'\n\tlist dns 'c'\n\tlist ifname 'eth1'\n"
+	require.NoError(t, r.(Importer).Import("network", strings.NewReader(snippet), ImportMerge))
+	values, _ := r.Get("network", "lan", "dns")
+	assert.Equal([]string{"a", "b", "c"}, values)
+	values, _ = r.Get("network", "lan", "ifname")
+	assert.Equal([]string{"eth0", "eth1"}, values)
+
+	require.NoError(t, r.(Importer).Import("network", strings.NewReader(snippet), ImportMergeReplaceLists))
+	values, _ = r.Get("network", "lan", "dns")
+	assert.Equal([]string{"c"}, values)
+	values, _ = r.Get("network", "lan", "ifname")
+	assert.Equal([]string{"eth1"}, values)
+
+	// retype
+	require.NoError(t, r.(Importer).Import("network", strings.NewReader("config alias 'lan'\n"), ImportMerge))
+	sections, _ := r.GetSections("network", "alias")
+	assert.Equal([]string{"lan"}, sections)
+}
+
+func TestImport_new(t *testing.T) {
+	dir := t.TempDir()
+	r := NewTree(dir)
+	require.NoError(t, r.(Importer).Import("system", strings.NewReader("config system\n\toption hostname 'OpenWrt'\n"), ImportMerge))
+	value, ok := r.GetLast("system", "@system[0]", "hostname")
+	assert.True(t, ok)
+	assert.Equal(t, "OpenWrt", value)
+}
+
+func TestImport_invalid(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "network", importTestConfig)
+	r := NewTree(dir)
+
+	assert.Error(r.(Importer).Import("network", strings.NewReader("config interface 'lan\n"), ImportMerge))
+	assert.Error(r.(Importer).Import("network", strings.NewReader("package network\n"), ImportReplace))
+
+	value, _ := r.GetLast("network", "lan", "ipaddr")
+	assert.Equal("192.168.1.1", value)
+	sections, _ := r.GetSections("network", "rule")
+	assert.Len(sections, 1)
+}
+
+func TestImporter(t *testing.T) {
+	assert := assert.New(t)
+	r := NewTree(t.TempDir())
+
+	assert.Implements((*Importer)(nil), r)
+	assert.Implements((*Importer)(nil), ReadOnly(r))
+	assert.Implements((*Importer)(nil), r.(Cloner).Clone())
+
+	// forks of trees without import support
+	f := &Fork{Tree: struct{ Tree }{r}}
+	var nsErr ErrNotSupported
+	assert.ErrorAs(f.Import("network", strings.NewReader(importTestSnippet), ImportMerge), &nsErr)
+	assert.Equal("Import", nsErr.Op)
+}
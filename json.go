@@ -0,0 +1,390 @@
+package uci
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// ErrInvalidJSON is returned by NewJSONTree, if the input is valid JSON,
+// but does not match the expected structure.
+var ErrInvalidJSON = errors.New("invalid JSON document")
+
+// JSONFormat selects the JSON representation used by WriteJSON and
+// NewJSONTree. Both formats are objects keyed by config name, with the
+// configs sorted by name, and sections and options in file order. Option
+// values are strings, list values are arrays of strings.
+type JSONFormat int
+
+const (
+	// JSONStable represents each config as array of sections, and
+	// each section as object with the members "name" (omitted for
+	// unnamed sections), "type" and "options":
+	//
+	//	{"network":[
+	//	  {"name":"lan","type":"interface","options":{"proto":"static","dns":["1.1.1.1"]}},
+	//	  {"type":"rule","options":{"name":"Allow-Ping"}}
+	//	]}
+	//
+	// The format is lossless: a tree read with NewJSONTree has the same
+	// content as the tree written with WriteJSON.
+	JSONStable JSONFormat = iota
+
+	// JSONUbus represents each config in the shape of the "values"
+	// member of the response to "ubus call uci get" (as implemented by
+	// rpcd), i.e. as object keyed by section name. Unnamed sections are
+	// named with generated IDs (see ShowOptions.Anonymous), and each
+	// section carries its metadata in the members ".anonymous", ".type",
+	// ".name" and ".index":
+	//
+	//	{"network":{
+	//	  "lan":{".anonymous":false,".type":"interface",".name":"lan",".index":0,"proto":"static","dns":["1.1.1.1"]},
+	//	  "cfg0292bd":{".anonymous":true,".type":"rule",".name":"cfg0292bd",".index":1,"name":"Allow-Ping"}
+	//	}}
+	//
+	// When reading, sections are ordered by ".index" (if present).
+	JSONUbus
+)
+
+// MarshalJSON implements encoding/json.Marshaler, using the JSONStable
+// format.
+func (s *TreeSnapshot) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := WriteJSON(&buf, s, JSONStable); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteJSON writes the given configs (or all configs in the snapshot, if
+// none are given) to w in the given format. A config missing in the
+// snapshot is skipped.
+func WriteJSON(w io.Writer, s *TreeSnapshot, format JSONFormat, configs ...string) error {
+	if len(configs) == 0 {
+		configs = s.Configs()
+	} else {
+		configs = append([]string(nil), configs...)
+		sort.Strings(configs)
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteByte('{')
+	first := true
+	for _, name := range configs {
+		cfg, ok := s.configs[name]
+		if !ok {
+			continue
+		}
+		if !first {
+			bw.WriteByte(',')
+		}
+		first = false
+		writeJSONString(bw, name)
+		bw.WriteByte(':')
+		if format == JSONUbus {
+			writeUbusConfig(bw, cfg)
+		} else {
+			writeStableConfig(bw, cfg)
+		}
+	}
+	bw.WriteByte('}')
+	return bw.Flush()
+}
+
+func writeStableConfig(bw *bufio.Writer, cfg *config) {
+	bw.WriteByte('[')
+	for i, sec := range cfg.Sections {
+		if i > 0 {
+			bw.WriteByte(',')
+		}
+		bw.WriteByte('{')
+		if sec.Name != "" {
+			bw.WriteString(`"name":`)
+			writeJSONString(bw, sec.Name)
+			bw.WriteByte(',')
+		}
+		bw.WriteString(`"type":`)
+		writeJSONString(bw, sec.Type)
+		bw.WriteString(`,"options":{`)
+		writeJSONOptions(bw, sec)
+		bw.WriteString("}}")
+	}
+	bw.WriteByte(']')
+}
+
+func writeUbusConfig(bw *bufio.Writer, cfg *config) {
+	bw.WriteByte('{')
+	for i, sec := range cfg.Sections {
+		if i > 0 {
+			bw.WriteByte(',')
+		}
+		name := sec.Name
+		if name == "" {
+			name = anonymousName(i+1, sec.Type)
+		}
+		writeJSONString(bw, name)
+		fmt.Fprintf(bw, `:{".anonymous":%t,".type":`, sec.Name == "")
+		writeJSONString(bw, sec.Type)
+		bw.WriteString(`,".name":`)
+		writeJSONString(bw, name)
+		fmt.Fprintf(bw, `,".index":%d`, i)
+		if len(sec.Options) > 0 {
+			bw.WriteByte(',')
+			writeJSONOptions(bw, sec)
+		}
+		bw.WriteByte('}')
+	}
+	bw.WriteByte('}')
+}
+
+// writeJSONOptions writes the options of sec as object members.
+func writeJSONOptions(bw *bufio.Writer, sec *section) {
+	for i, opt := range sec.Options {
+		if i > 0 {
+			bw.WriteByte(',')
+		}
+		writeJSONString(bw, opt.Name)
+		bw.WriteByte(':')
+		if opt.Type != TypeList && len(opt.Values) > 0 {
+			writeJSONString(bw, opt.Values[len(opt.Values)-1])
+			continue
+		}
+		bw.WriteByte('[')
+		for j, v := range opt.Values {
+			if j > 0 {
+				bw.WriteByte(',')
+			}
+			writeJSONString(bw, v)
+		}
+		bw.WriteByte(']')
+	}
+}
+
+func writeJSONString(bw *bufio.Writer, s string) {
+	b, _ := json.Marshal(s) // never fails for strings
+	bw.Write(b)
+}
+
+// NewJSONTree creates an in-memory tree from a JSON document in the given
+// format, as written by WriteJSON. In the JSONUbus format, sections with
+// ".anonymous" set to true are read as unnamed sections.
+//
+// The tree behaves like a tree created by NewArchiveTree: it can be read
+// and modified, but not committed.
+func NewJSONTree(r io.Reader, format JSONFormat) (Tree, error) {
+	configs := make(map[string]*config)
+	d := jsonDecoder{json.NewDecoder(r)}
+
+	err := d.object(func(name string) error {
+		if name == "" {
+			return fmt.Errorf("%w: empty config name", ErrInvalidJSON)
+		}
+		if _, ok := configs[name]; ok {
+			return fmt.Errorf("%w: duplicate config %q", ErrInvalidJSON, name)
+		}
+		cfg := newConfig(name)
+		var err error
+		if format == JSONUbus {
+			err = d.ubusConfig(cfg)
+		} else {
+			err = d.stableConfig(cfg)
+		}
+		if err != nil {
+			return fmt.Errorf("config %q: %w", name, err)
+		}
+		configs[name] = cfg
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("json: %w", err)
+	}
+	if _, err = d.Token(); err != io.EOF {
+		return nil, fmt.Errorf("json: %w: trailing data", ErrInvalidJSON)
+	}
+	return newMemoryTree(configs)
+}
+
+// jsonDecoder reads JSON documents token by token, to preserve the order
+// of object members.
+type jsonDecoder struct {
+	*json.Decoder
+}
+
+// delim consumes the given delimiter.
+func (d jsonDecoder) delim(want json.Delim) error {
+	tok, err := d.Token()
+	if err != nil {
+		return err
+	}
+	if tok != want {
+		return fmt.Errorf("%w: expected %q, got %v", ErrInvalidJSON, want, tok)
+	}
+	return nil
+}
+
+// object reads an object, calling fn for each member. fn must consume
+// the member's value.
+func (d jsonDecoder) object(fn func(key string) error) error {
+	if err := d.delim('{'); err != nil {
+		return err
+	}
+	for d.More() {
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+		if err = fn(tok.(string)); err != nil {
+			return err
+		}
+	}
+	return d.delim('}')
+}
+
+// string reads a string value.
+func (d jsonDecoder) string() (string, error) {
+	var s string
+	if err := d.Decode(&s); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidJSON, err)
+	}
+	return s, nil
+}
+
+// skip consumes a value of any type.
+func (d jsonDecoder) skip() error {
+	var v json.RawMessage
+	return d.Decode(&v)
+}
+
+// option reads the value of an option, which is either a string or an
+// array of strings (for lists).
+func (d jsonDecoder) option(name string) (*option, error) {
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	switch v := v.(type) {
+	case string:
+		return newOption(name, TypeOption, v), nil
+	case []interface{}:
+		values := make([]string, len(v))
+		for i, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%w: option %q: expected string list item, got %T", ErrInvalidJSON, name, item)
+			}
+			values[i] = s
+		}
+		return newOption(name, TypeList, values...), nil
+	}
+	return nil, fmt.Errorf("%w: option %q: expected string or list, got %T", ErrInvalidJSON, name, v)
+}
+
+func (d jsonDecoder) stableConfig(cfg *config) error {
+	if err := d.delim('['); err != nil {
+		return err
+	}
+	for d.More() {
+		sec := newSection("", "")
+		err := d.object(func(key string) (err error) {
+			switch key {
+			case "name":
+				sec.Name, err = d.string()
+			case "type":
+				sec.Type, err = d.string()
+			case "options":
+				err = d.object(func(name string) error {
+					opt, err := d.option(name)
+					if err == nil {
+						sec.Merge(opt)
+					}
+					return err
+				})
+			default:
+				err = d.skip()
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if err = addJSONSection(cfg, sec); err != nil {
+			return err
+		}
+	}
+	return d.delim(']')
+}
+
+func (d jsonDecoder) ubusConfig(cfg *config) error {
+	type indexed struct {
+		*section
+		index int
+	}
+	var sections []indexed
+
+	err := d.object(func(name string) error {
+		sec := indexed{newSection("", name), len(sections)}
+		var anonymous bool
+		err := d.object(func(key string) (err error) {
+			switch key {
+			case ".anonymous":
+				err = d.Decode(&anonymous)
+			case ".type":
+				sec.Type, err = d.string()
+			case ".index":
+				err = d.Decode(&sec.index)
+			case ".name":
+				err = d.skip() // the member name is authoritative
+			default:
+				if key != "" && key[0] == '.' {
+					return d.skip() // other metadata
+				}
+				var opt *option
+				if opt, err = d.option(key); err == nil {
+					sec.Merge(opt)
+				}
+			}
+			if err != nil {
+				return fmt.Errorf("section %q: %w", name, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if anonymous {
+			sec.Name = ""
+		}
+		sections = append(sections, sec)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.SliceStable(sections, func(i, j int) bool {
+		return sections[i].index < sections[j].index
+	})
+	for _, sec := range sections {
+		if err = addJSONSection(cfg, sec.section); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addJSONSection appends sec to cfg, rejecting duplicate or untyped
+// sections.
+func addJSONSection(cfg *config, sec *section) error {
+	if sec.Type == "" {
+		return fmt.Errorf("%w: section %q has no type", ErrInvalidJSON, sec.Name)
+	}
+	if sec.Name != "" && cfg.getNamed(sec.Name) != nil {
+		return fmt.Errorf("%w: duplicate section %q", ErrInvalidJSON, sec.Name)
+	}
+	cfg.Add(sec)
+	return nil
+}
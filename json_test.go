@@ -0,0 +1,114 @@
+package uci
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteJSON(t *testing.T) {
+	assert := assert.New(t)
+	s := testSnapshot(t, "network", showTestConfig)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteJSON(&buf, s, JSONStable))
+	assert.Equal(`{"network":[`+
+		`{"name":"lan","type":"interface","options":{"proto":"static","ipaddr":"192.168.1.1","dns":["1.1.1.1","8.8.8.8"]}},`+
+		`{"type":"rule","options":{"name":"it's"}},`+
+		`{"type":"rule","options":{"name":"Allow-Ping"}}]}`, buf.String())
+
+	b, err := json.Marshal(struct{ Tree *TreeSnapshot }{s})
+	require.NoError(t, err)
+	assert.Equal(`{"Tree":`+buf.String()+`}`, string(b))
+
+	buf.Reset()
+	require.NoError(t, WriteJSON(&buf, s, JSONUbus, "network", "missing"))
+	var v map[string]map[string]map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &v))
+	assert.Len(v["network"], 3)
+	assert.Equal(map[string]interface{}{
+		".anonymous": false,
+		".type":      "interface",
+		".name":      "lan",
+		".index":     float64(0),
+		"proto":      "static",
+		"ipaddr":     "192.168.1.1",
+		"dns":        []interface{}{"1.1.1.1", "8.8.8.8"},
+	}, v["network"]["lan"])
+
+	const id = "cfg0392bd" // third section
+	assert.Equal(map[string]interface{}{
+		".anonymous": true,
+		".type":      "rule",
+		".name":      id,
+		".index":     float64(2),
+		"name":       "Allow-Ping",
+	}, v["network"][id])
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	for _, format := range []JSONFormat{JSONStable, JSONUbus} {
+		s := testSnapshot(t, "network", showTestConfig)
+		var buf bytes.Buffer
+		require.NoError(t, WriteJSON(&buf, s, format))
+
+		r, err := NewJSONTree(&buf, format)
+		require.NoError(t, err)
+		s2, err := r.Snapshot()
+		require.NoError(t, err)
+		assert.Empty(t, DiffConfig(s, s2, "network", DiffOptions{}), format)
+
+		values, ok := r.Get("network", "lan", "dns")
+		assert.True(t, ok)
+		assert.Equal(t, []string{"1.1.1.1", "8.8.8.8"}, values)
+		assert.ErrorIs(t, r.Commit(), ErrArchiveTree)
+	}
+}
+
+func TestNewJSONTree_ubus(t *testing.T) {
+	assert := assert.New(t)
+
+	// as returned by rpcd, but with shuffled members
+	r, err := NewJSONTree(strings.NewReader(`{"firewall":{
+		"cfg02e1b1": {".anonymous": true, ".type": "rule", ".name": "cfg02e1b1", ".index": 2, "name": "second"},
+		"lan": {".anonymous": false, ".type": "zone", ".name": "lan", ".index": 0, "network": ["lan", "guest"]},
+		"cfg01a2b3": {".anonymous": true, ".type": "rule", ".name": "cfg01a2b3", ".index": 1, ".unknown": 1, "name": "first"}
+	}}`), JSONUbus)
+	require.NoError(t, err)
+
+	sections, err := r.GetSections("firewall", "rule")
+	require.NoError(t, err)
+	assert.Equal([]string{"@rule[0]", "@rule[1]"}, sections)
+	value, _ := r.GetLast("firewall", "@rule[0]", "name")
+	assert.Equal("first", value)
+	values, _ := r.Get("firewall", "lan", "network")
+	assert.Equal([]string{"lan", "guest"}, values)
+}
+
+func TestNewJSONTree_invalid(t *testing.T) {
+	for _, tc := range []struct {
+		input  string
+		format JSONFormat
+	}{
+		{`{"network":[{"name":"lan"}]}`, JSONStable},
+		{`{"network":[{"type":"interface","options":{"proto":1}}]}`, JSONStable},
+		{`{"network":[{"type":"interface","options":{"dns":["a",1]}}]}`, JSONStable},
+		{`{"network":[{"name":"lan","type":"interface"},{"name":"lan","type":"interface"}]}`, JSONStable},
+		{`{"network":{}}`, JSONStable},
+		{`{"":[]}`, JSONStable},
+		{`{"network":[]}{}`, JSONStable},
+		{`{"network":{"lan":{".anonymous":"no",".type":"interface"}}}`, JSONUbus},
+		{`{"network":{"lan":{".name":"lan"}}}`, JSONUbus},
+		{`[]`, JSONUbus},
+	} {
+		_, err := NewJSONTree(strings.NewReader(tc.input), tc.format)
+		assert.Error(t, err, tc.input)
+	}
+
+	_, err := NewJSONTree(strings.NewReader(`{"network":[{"type":"interface","options":{"proto":1}}]}`), JSONStable)
+	assert.ErrorIs(t, err, ErrInvalidJSON)
+}
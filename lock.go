@@ -0,0 +1,128 @@
+package uci
+
+import "sort"
+
+// Locking rules
+//
+// The tree's mutex (tree.mu) guards the configs map and the tree's
+// settings. Each config has its own mutex (config.mu) guarding its
+// sections and tainted flag:
+//
+//   - Operations on a single config hold tree.mu for reading, and lock
+//     the config either shared (reads) or exclusively (writes). Hence
+//     reads never block each other, and writes only block operations on
+//     the same config.
+//   - Operations replacing or removing configs from the map (Revert,
+//     LoadConfig, Restore, ...) lock tree.mu exclusively. They wait for
+//     all in-flight operations, and need not lock the configs.
+//   - tree.mu is always acquired before any config lock, and must not be
+//     acquired recursively. Multiple configs are locked in order of
+//     their names.
+//   - No lock is held while calling commit hooks, but validators are
+//     called while the configs are locked for reading.
+
+// touch marks a config as modified. Its call must be guarded by locking
+// the config exclusively.
+func (c *config) touch() {
+	c.tainted = true
+	c.gen++
+	c.frozen.Store(nil)
+}
+
+// lookupValues returns a copy of the values of an option, and whether
+// the section exists.
+func (c *config) lookupValues(section, option string) ([]string, bool) {
+	sec := c.Get(section)
+	if sec == nil {
+		return nil, false
+	}
+	opt := sec.Get(option)
+	if opt == nil {
+		return nil, true
+	}
+	return append([]string(nil), opt.Values...), true
+}
+
+// acquire returns a config, loading it first if necessary. On success,
+// the tree's mutex is held for reading, and the config is locked (shared
+// or exclusively). The caller must call release afterwards.
+func (t *tree) acquire(name string, exclusive bool) (cfg *config, release func(), err error) {
+	for {
+		if cfg, release, ok := t.lookup(name, exclusive); ok {
+			return cfg, release, nil
+		}
+
+		// Read the file without holding any lock. If another goroutine
+		// has loaded the config in the meantime, we use that version.
+		loaded, err := t.readConfig(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		t.mu.Lock()
+		if _, ok := t.configs[name]; !ok {
+			t.setConfig(loaded)
+		}
+		t.mu.Unlock()
+	}
+}
+
+// lookup works like acquire, but does not load missing configs.
+func (t *tree) lookup(name string, exclusive bool) (cfg *config, release func(), ok bool) {
+	t.mu.RLock()
+	cfg, ok = t.configs[name]
+	if !ok {
+		t.mu.RUnlock()
+		return nil, nil, false
+	}
+
+	if exclusive {
+		cfg.mu.Lock()
+		return cfg, func() {
+			cfg.mu.Unlock()
+			t.mu.RUnlock()
+		}, true
+	}
+	cfg.mu.RLock()
+	return cfg, func() {
+		cfg.mu.RUnlock()
+		t.mu.RUnlock()
+	}, true
+}
+
+// create works like acquire (with an exclusive lock), but adds an empty
+// config, if it is neither loaded nor readable.
+func (t *tree) create(name string) (cfg *config, release func()) {
+	for {
+		if cfg, release, ok := t.lookup(name, true); ok {
+			return cfg, release
+		}
+		t.mu.Lock()
+		if _, ok := t.configs[name]; !ok {
+			t.setConfig(newConfig(name))
+		}
+		t.mu.Unlock()
+	}
+}
+
+// rlockConfigs locks the given configs for reading (in order of their
+// names), and returns their generation counters.
+func rlockConfigs(configs []*config) []uint64 {
+	sorted := append([]*config(nil), configs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	for _, cfg := range sorted {
+		cfg.mu.RLock()
+	}
+
+	gens := make([]uint64, len(configs))
+	for i, cfg := range configs {
+		gens[i] = cfg.gen
+	}
+	return gens
+}
+
+// runlockConfigs releases the locks acquired by rlockConfigs.
+func runlockConfigs(configs []*config) {
+	for _, cfg := range configs {
+		cfg.mu.RUnlock()
+	}
+}
@@ -0,0 +1,170 @@
+package uci
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrentAccess(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{"alpha", "beta", "gamma"}
+	for _, name := range names {
+		writeTestConfig(t, dir, name, "config main 'main'\n\toption counter '0'\n")
+	}
+	r := NewTree(dir)
+
+	const workers, rounds = 8, 50
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				name := names[(w+i)%len(names)]
+				switch i % 6 {
+				case 0:
+					assert.NoError(t, r.SetType(name, "main", "counter", TypeOption, fmt.Sprint(i)))
+				case 1:
+					_, ok := r.Get(name, "main", "counter")
+					assert.True(t, ok)
+				case 2:
+					_, err := r.GetSections(name, "main")
+					assert.NoError(t, err)
+				case 3:
+					sec := fmt.Sprintf("w%d_%d", w, i)
+					assert.NoError(t, r.AddSection(name, sec, "extra"))
+					assert.NoError(t, r.DelSection(name, sec))
+				case 4:
+					assert.NoError(t, r.Commit(name))
+				case 5:
+					_, err := r.(DryRunner).DryRun()
+					assert.NoError(t, err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	require.NoError(t, r.Commit())
+	for _, name := range names {
+		_, ok := r.GetLast(name, "main", "counter")
+		assert.True(t, ok, name)
+	}
+}
+
+func TestConcurrentLoad(t *testing.T) {
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "test", "config main 'main'\n\toption enabled '1'\n")
+	r := NewTree(dir)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			enabled, ok := r.GetBool("test", "main", "enabled")
+			assert.True(t, ok)
+			assert.True(t, enabled)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCommitDoesNotBlockReaders(t *testing.T) {
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "slow", "config main 'main'\n")
+	writeTestConfig(t, dir, "other", "config main 'main'\n")
+	r := NewTree(dir)
+
+	entered, proceed := make(chan struct{}), make(chan struct{})
+	r.(ValidatorRegistrar).AddValidator("slow", func(ConfigView) error {
+		close(entered)
+		<-proceed
+		return nil
+	})
+	require.NoError(t, r.SetType("slow", "main", "foo", TypeOption, "bar"))
+	require.NoError(t, r.LoadConfig("other", false))
+
+	done := make(chan error)
+	go func() { done <- r.Commit("slow") }()
+	<-entered
+
+	// the committing config can be read, other configs can be modified
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		values, ok := r.Get("slow", "main", "foo")
+		assert.True(t, ok)
+		assert.Equal(t, []string{"bar"}, values)
+		assert.NoError(t, r.SetType("other", "main", "foo", TypeOption, "baz"))
+	}()
+
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("blocked by commit")
+	}
+	close(proceed)
+	require.NoError(t, <-done)
+}
+
+func TestReloadKeepsConcurrentChanges(t *testing.T) {
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "test", "config main 'main'\n\toption value 'disk'\n")
+	r := NewTree(dir).(*tree)
+
+	for i := 0; i < 100; i++ {
+		r.Revert()
+		require.NoError(t, r.LoadConfig("test", false))
+		writeTestConfig(t, dir, "test", fmt.Sprintf("config main 'main'\n\toption value 'disk%d'\n", i))
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			r.reloadChanged("test")
+		}()
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, r.SetType("test", "main", "value", TypeOption, "memory"))
+		}()
+		wg.Wait()
+
+		value, _ := r.GetLast("test", "main", "value")
+		require.Equal(t, "memory", value, "round %d", i)
+	}
+}
+
+func TestGetKeepsConcurrentChanges(t *testing.T) {
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "test", "config main 'main'\n\toption value 'disk'\n")
+	r := NewTree(dir)
+
+	for i := 0; i < 100; i++ {
+		r.Revert() // unload
+
+		var wg sync.WaitGroup
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			r.Get("test", "main", "value")
+		}()
+		go func() {
+			defer wg.Done()
+			r.Get("test", "missing", "value")
+		}()
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, r.SetType("test", "main", "value", TypeOption, "memory"))
+		}()
+		wg.Wait()
+
+		value, _ := r.GetLast("test", "main", "value")
+		require.Equal(t, "memory", value, "round %d", i)
+	}
+}
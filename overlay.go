@@ -0,0 +1,213 @@
+package uci
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DefaultROMPath points to the pristine default configs on OpenWrt
+// devices (the read-only squashfs image).
+const DefaultROMPath = "/rom/etc/config"
+
+// OverlayTree is a Tree, which additionally knows the default version
+// of each config (e.g. in /rom/etc/config), as found on OpenWrt devices
+// with an overlay file system.
+//
+// Configs missing in the ROM directory are treated as empty.
+type OverlayTree interface {
+	Tree
+
+	// Modified lists the differences between the default version of a
+	// config and its current state (including pending changes).
+	Modified(config string) ([]Change, error)
+
+	// DiffDefault renders the differences between the default version
+	// of a config and its current state as unified diff. It returns an
+	// empty string, if there are no differences.
+	DiffDefault(config string) (string, error)
+
+	// IsDefault reports whether an option has its default value (an
+	// option missing in both versions is considered to be default).
+	IsDefault(config, section, option string) (bool, error)
+
+	// ResetConfig replaces a config with its default version.
+	ResetConfig(config string) error
+
+	// ResetSection restores a section to its default. A section without
+	// default is removed.
+	ResetSection(config, section string) error
+
+	// ResetOption restores an option to its default. An option without
+	// default is removed.
+	ResetOption(config, section, option string) error
+}
+
+type overlayTree struct {
+	*tree
+	rom string
+}
+
+var _ OverlayTree = (*overlayTree)(nil)
+
+// NewOverlayTree constructs a tree for the configs in root, with their
+// default versions in rom. Resetting to the defaults only affects the
+// in-memory configs; use Commit to write them.
+func NewOverlayTree(root, rom string) OverlayTree {
+	return &overlayTree{
+		tree: NewTree(root).(*tree),
+		rom:  rom,
+	}
+}
+
+// defaultConfig reads the default version of a config.
+func (t *overlayTree) defaultConfig(name string) (*config, error) {
+	body, err := os.ReadFile(filepath.Join(t.rom, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return newConfig(name), nil
+	} else if err != nil {
+		return nil, fmt.Errorf("reading default config failed: %w", err)
+	}
+	cfg, err := parse(name, string(body))
+	if err != nil {
+		return nil, fmt.Errorf("parse: %w", err)
+	}
+	return cfg, nil
+}
+
+// currentConfig returns the in-memory version of a config, loading it
+// if necessary, and locks it like tree.acquire. A config missing on disk
+// yields an empty config, which is only added to the tree if exclusive
+// is true. The caller must call release afterwards.
+func (t *overlayTree) currentConfig(name string, exclusive bool) (cfg *config, release func(), err error) {
+	cfg, release, err = t.acquire(name, exclusive)
+	if err == nil {
+		return cfg, release, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("ensureConfigLoaded: %w", err)
+	}
+	if exclusive {
+		cfg, release = t.create(name)
+		return cfg, release, nil
+	}
+	return newConfig(name), func() {}, nil
+}
+
+func (t *overlayTree) Modified(name string) ([]Change, error) {
+	def, err := t.defaultConfig(name)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, release, err := t.currentConfig(name, false)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return diffConfigs(def, cfg), nil
+}
+
+func (t *overlayTree) DiffDefault(name string) (string, error) {
+	def, err := t.defaultConfig(name)
+	if err != nil {
+		return "", err
+	}
+
+	cfg, release, err := t.currentConfig(name, false)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	var a, b bytes.Buffer
+	_, _ = def.WriteTo(&a)
+	_, _ = cfg.WriteTo(&b)
+	return unifiedDiff(
+		filepath.Join(t.rom, name),
+		filepath.Join(t.dir, name),
+		a.String(), b.String()), nil
+}
+
+func (t *overlayTree) IsDefault(name, section, opt string) (bool, error) {
+	def, err := t.defaultConfig(name)
+	if err != nil {
+		return false, err
+	}
+
+	cfg, release, err := t.currentConfig(name, false)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	var cur, orig *option
+	if sec := cfg.Get(section); sec != nil {
+		cur = sec.Get(opt)
+	}
+	if sec := def.Get(section); sec != nil {
+		orig = sec.Get(opt)
+	}
+	if cur == nil || orig == nil {
+		return cur == orig, nil
+	}
+	return cur.Type == orig.Type && equalValues(cur.Values, orig.Values), nil
+}
+
+func (t *overlayTree) ResetConfig(name string) error {
+	def, err := t.defaultConfig(name)
+	if err != nil {
+		return err
+	}
+
+	return t.reset(name, func(cfg *config) error {
+		cfg.Sections = def.clone().Sections
+		return nil
+	})
+}
+
+func (t *overlayTree) ResetSection(name, section string) error {
+	def, err := t.defaultConfig(name)
+	if err != nil {
+		return err
+	}
+
+	return t.reset(name, func(cfg *config) error {
+		restoreSection(cfg, def, section)
+		return nil
+	})
+}
+
+func (t *overlayTree) ResetOption(name, section, opt string) error {
+	def, err := t.defaultConfig(name)
+	if err != nil {
+		return err
+	}
+
+	return t.reset(name, func(cfg *config) error {
+		return restoreOption(cfg, def, section, opt)
+	})
+}
+
+// reset applies fn to the in-memory version of a config, and updates its
+// tainted flag.
+func (t *overlayTree) reset(name string, fn func(*config) error) error {
+	cfg, release, err := t.currentConfig(name, true)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if err = fn(cfg); err != nil {
+		return err
+	}
+	cfg.touch()
+	base, err := t.committedConfig(name)
+	if err != nil {
+		return err
+	}
+	cfg.tainted = !cfg.equal(base)
+	return nil
+}
@@ -0,0 +1,108 @@
+package uci
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestOverlay(t *testing.T) (OverlayTree, string, string) {
+	t.Helper()
+
+	live, rom := t.TempDir(), t.TempDir()
+	writeTestConfig(t, rom, "network", `
+config interface 'lan'
+	option proto 'static'
+	option ipaddr '192.168.1.1'
+
+config interface 'wan'
+	option proto 'dhcp'
+`)
+	writeTestConfig(t, live, "network", `
+config interface 'lan'
+	option proto 'static'
+	option ipaddr '10.0.0.1'
+	option dns '9.9.9.9'
+
+config interface 'guest'
+	option proto 'static'
+`)
+	writeTestConfig(t, rom, "system", "config system\n\toption hostname 'OpenWrt'\n")
+	return NewOverlayTree(live, rom), live, rom
+}
+
+func TestOverlayModified(t *testing.T) {
+	assert := assert.New(t)
+	r, live, rom := newTestOverlay(t)
+
+	changes, err := r.Modified("network")
+	require.NoError(t, err)
+	assert.Equal([]Change{
+		{Type: SectionRemoved, Section: "wan", SectionType: "interface"},
+		{Type: OptionSet, Section: "lan", SectionType: "interface", Option: "ipaddr", Values: []string{"10.0.0.1"}},
+		{Type: OptionSet, Section: "lan", SectionType: "interface", Option: "dns", Values: []string{"9.9.9.9"}},
+		{Type: SectionAdded, Section: "guest", SectionType: "interface"},
+		{Type: OptionSet, Section: "guest", SectionType: "interface", Option: "proto", Values: []string{"static"}},
+	}, changes)
+
+	// missing in live directory
+	changes, err = r.Modified("system")
+	require.NoError(t, err)
+	assert.Equal([]Change{{Type: SectionRemoved, Section: "@system[0]", SectionType: "system"}}, changes)
+
+	diff, err := r.DiffDefault("network")
+	require.NoError(t, err)
+	assert.Contains(diff, "--- "+filepath.Join(rom, "network")+"\n+++ "+filepath.Join(live, "network")+"\n")
+	assert.Contains(diff, "-\toption ipaddr '192.168.1.1'\n+\toption ipaddr '10.0.0.1'\n")
+
+	for opt, expected := range map[string]bool{
+		"proto":  true,
+		"ipaddr": false,
+		"dns":    false,
+		"foo":    true,
+	} {
+		isDefault, err := r.IsDefault("network", "lan", opt)
+		require.NoError(t, err)
+		assert.Equal(expected, isDefault, opt)
+	}
+}
+
+func TestOverlayReset(t *testing.T) {
+	assert := assert.New(t)
+	r, _, _ := newTestOverlay(t)
+
+	require.NoError(t, r.ResetOption("network", "lan", "ipaddr"))
+	require.NoError(t, r.ResetOption("network", "lan", "dns"))
+	value, _ := r.GetLast("network", "lan", "ipaddr")
+	assert.Equal("192.168.1.1", value)
+	_, ok := r.GetLast("network", "lan", "dns")
+	assert.False(ok)
+	assert.ErrorAs(r.ResetOption("network", "wan", "proto"), &ErrSectionNotFound{})
+
+	require.NoError(t, r.ResetSection("network", "guest"))
+	require.NoError(t, r.ResetSection("network", "wan"))
+	names, err := r.GetSections("network", "interface")
+	require.NoError(t, err)
+	assert.Equal([]string{"lan", "wan"}, names)
+
+	changes, err := r.Modified("network")
+	require.NoError(t, err)
+	assert.Empty(changes)
+
+	// configs only present in ROM are created
+	require.NoError(t, r.ResetConfig("system"))
+	value, _ = r.GetLast("system", "@system[0]", "hostname")
+	assert.Equal("OpenWrt", value)
+
+	require.NoError(t, r.SetType("system", "@system[0]", "hostname", TypeOption, "changed"))
+	require.NoError(t, r.ResetConfig("system"))
+	value, _ = r.GetLast("system", "@system[0]", "hostname")
+	assert.Equal("OpenWrt", value)
+
+	require.NoError(t, r.Commit())
+	changes, err = NewOverlayTree(r.(*overlayTree).dir, r.(*overlayTree).rom).Modified("network")
+	require.NoError(t, err)
+	assert.Empty(changes)
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package uci
+
+import "os"
+
+// fileOwner is not supported on this platform.
+func fileOwner(os.FileInfo) (uid, gid int, ok bool) {
+	return -1, -1, false
+}
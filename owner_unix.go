@@ -0,0 +1,17 @@
+//go:build unix
+
+package uci
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileOwner extracts the owner's uid and gid from fi.
+func fileOwner(fi os.FileInfo) (uid, gid int, ok bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return -1, -1, false
+	}
+	return int(st.Uid), int(st.Gid), true
+}
@@ -0,0 +1,156 @@
+//go:build unix
+
+package uci
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommit_preserveMode(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "wireless", "config wifi-iface 'wlan0'\n\toption key 'secret'\n")
+	require.NoError(t, os.Chmod(filepath.Join(dir, "wireless"), 0o600))
+
+	r := NewTree(dir)
+	r.(FileModeSetter).SetFileMode("wireguard", 0o640)
+	require.NoError(t, r.SetType("wireless", "wlan0", "key", TypeOption, "geheim"))
+	require.NoError(t, r.AddSection("wireguard", "wg0", "interface"))
+	require.NoError(t, r.AddSection("network", "lan", "interface"))
+	require.NoError(t, r.Commit())
+
+	for name, mode := range map[string]os.FileMode{
+		"wireless":  0o600, // preserved
+		"wireguard": 0o640, // overridden
+		"network":   DefaultFileMode,
+	} {
+		fi, err := os.Stat(filepath.Join(dir, name))
+		require.NoError(t, err)
+		assert.Equal(mode, fi.Mode().Perm(), name)
+	}
+}
+
+func TestCommit_preserveOwner(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("changing file ownership requires root")
+	}
+
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "network", "config interface 'lan'\n")
+	require.NoError(t, os.Chown(filepath.Join(dir, "network"), 4223, 4224))
+
+	r := NewTree(dir)
+	require.NoError(t, r.SetType("network", "lan", "proto", TypeOption, "static"))
+	require.NoError(t, r.Commit())
+
+	fi, err := os.Stat(filepath.Join(dir, "network"))
+	require.NoError(t, err)
+	st := fi.Sys().(*syscall.Stat_t)
+	assert.EqualValues(4223, st.Uid)
+	assert.EqualValues(4224, st.Gid)
+}
+
+func TestCommit_symlink(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	confDir := filepath.Join(dir, "config")
+	realDir := filepath.Join(dir, "real")
+	require.NoError(t, os.Mkdir(confDir, 0o755))
+	require.NoError(t, os.Mkdir(realDir, 0o755))
+
+	writeTestConfig(t, realDir, "network", "config interface 'lan'\n")
+	require.NoError(t, os.Symlink("../real/network", filepath.Join(confDir, "network")))
+	// dangling symlink
+	require.NoError(t, os.Symlink(filepath.Join(realDir, "firewall"), filepath.Join(confDir, "firewall")))
+
+	r := NewTree(confDir)
+	require.NoError(t, r.SetType("network", "lan", "proto", TypeOption, "static"))
+	require.NoError(t, r.AddSection("firewall", "wan", "zone"))
+	require.NoError(t, r.Commit())
+
+	for _, name := range []string{"network", "firewall"} {
+		fi, err := os.Lstat(filepath.Join(confDir, name))
+		require.NoError(t, err)
+		assert.True(fi.Mode()&os.ModeSymlink != 0, "%s is no symlink anymore", name)
+		assert.FileExists(filepath.Join(realDir, name))
+	}
+
+	body, err := os.ReadFile(filepath.Join(realDir, "network"))
+	require.NoError(t, err)
+	assert.Contains(string(body), "option proto 'static'")
+}
+
+// ownerTmpFile wraps a real temp file, pretending that it belongs to
+// another user if foreign is set, and refusing to change its ownership.
+type ownerTmpFile struct {
+	*tmpFileImpl
+	foreign bool
+	chowns  int
+}
+
+type foreignFileInfo struct{ os.FileInfo }
+
+func (foreignFileInfo) Sys() interface{} { return &syscall.Stat_t{Uid: 4223, Gid: 4224} }
+
+func (f *ownerTmpFile) Stat() (os.FileInfo, error) {
+	fi, err := f.tmpFileImpl.Stat()
+	if err != nil || !f.foreign {
+		return fi, err
+	}
+	return foreignFileInfo{fi}, nil
+}
+
+func (f *ownerTmpFile) Chown(int, int) error {
+	f.chowns++
+	return &os.PathError{Op: "chown", Path: f.Name(), Err: syscall.EPERM}
+}
+
+func TestCommit_ownerUnprivileged(t *testing.T) {
+	origNewTmpFile, origGeteuid := newTmpFile, geteuid
+	defer func() { newTmpFile, geteuid = origNewTmpFile, origGeteuid }()
+
+	for _, tc := range []struct {
+		foreign bool
+		euid    int
+		chowns  int
+		fails   bool
+	}{
+		{foreign: false, euid: 1000, chowns: 0}, // ownership matches
+		{foreign: true, euid: 1000, chowns: 1},  // EPERM ignored
+		{foreign: true, euid: 0, chowns: 1, fails: true},
+	} {
+		dir := t.TempDir()
+		writeTestConfig(t, dir, "network", "config interface 'lan'\n")
+
+		var tmp *ownerTmpFile
+		newTmpFile = func(dir, pattern string) (tmpFile, error) {
+			f, err := origNewTmpFile(dir, pattern)
+			if err != nil {
+				return nil, err
+			}
+			tmp = &ownerTmpFile{tmpFileImpl: f.(*tmpFileImpl), foreign: tc.foreign}
+			return tmp, nil
+		}
+		geteuid = func() int { return tc.euid }
+
+		r := NewTree(dir)
+		require.NoError(t, r.SetType("network", "lan", "proto", TypeOption, "static"))
+		err := r.Commit()
+		assert.Equal(t, tc.chowns, tmp.chowns, "%+v", tc)
+		if tc.fails {
+			assert.ErrorIs(t, err, os.ErrPermission, "%+v", tc)
+			continue
+		}
+		require.NoError(t, err, "%+v", tc)
+		body, err := os.ReadFile(filepath.Join(dir, "network"))
+		require.NoError(t, err)
+		assert.Contains(t, string(body), "option proto 'static'")
+	}
+}
@@ -0,0 +1,317 @@
+package uci
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrInvalidPath is returned by ParsePath for malformed paths.
+var ErrInvalidPath = errors.New("invalid path")
+
+// A Path addresses a config, a section or an option in the notation of
+// the uci CLI, e.g. "network.lan.ipaddr" or "firewall.@zone[1].network".
+// Section and Option are empty for shorter paths.
+type Path struct {
+	Config  string
+	Section string // name or selector (e.g. "@zone[1]")
+	Option  string
+}
+
+// ParsePath parses a dotted path. Segments may be quoted (with single or
+// double quotes), e.g. to include dots; outside of single quotes, a
+// backslash escapes the next character. Section selectors are checked
+// for syntax errors.
+func ParsePath(s string) (Path, error) {
+	var (
+		segments []string
+		seg      strings.Builder
+		quote    rune
+	)
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == '\'':
+			seg.WriteRune(c)
+		case c == '\\' && i+1 < len(runes):
+			i++
+			seg.WriteRune(runes[i])
+		case quote == '"':
+			seg.WriteRune(c)
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '.':
+			segments = append(segments, seg.String())
+			seg.Reset()
+		default:
+			seg.WriteRune(c)
+		}
+	}
+	if quote != 0 {
+		return Path{}, fmt.Errorf("%w %q: %v", ErrInvalidPath, s, errBatchUnterminated)
+	}
+	segments = append(segments, seg.String())
+
+	if len(segments) > 3 {
+		return Path{}, fmt.Errorf("%w %q: too many components", ErrInvalidPath, s)
+	}
+	for _, seg := range segments {
+		if seg == "" {
+			return Path{}, fmt.Errorf("%w %q: empty component", ErrInvalidPath, s)
+		}
+	}
+
+	var p Path
+	p.Config = segments[0]
+	if len(segments) > 1 {
+		p.Section = segments[1]
+		if strings.HasPrefix(p.Section, "@") {
+			if _, _, err := unmangleSectionName(p.Section); err != nil {
+				return Path{}, fmt.Errorf("%w %q: %v", ErrInvalidPath, s, err)
+			}
+		}
+	}
+	if len(segments) > 2 {
+		p.Option = segments[2]
+	}
+	return p, nil
+}
+
+// MustParsePath works like ParsePath, but panics on errors.
+func MustParsePath(s string) Path {
+	p, err := ParsePath(s)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// String returns the path in dotted notation. Segments containing dots,
+// quotes, backslashes or whitespace are quoted.
+func (p Path) String() string {
+	segments := []string{p.Config}
+	if p.Section != "" {
+		segments = append(segments, p.Section)
+	}
+	if p.Option != "" {
+		segments = append(segments, p.Option)
+	}
+	for i, seg := range segments {
+		if seg == "" || strings.ContainsAny(seg, ".'\"\\ \t") {
+			segments[i] = quoteBatch(seg)
+		}
+	}
+	return strings.Join(segments, ".")
+}
+
+// PathError is returned by the path-based methods of Tree, if a path
+// cannot be resolved. Component holds the path segment that failed.
+type PathError struct {
+	Path      Path
+	Component string
+	Err       error
+}
+
+func (err *PathError) Error() string {
+	return fmt.Sprintf("%s: cannot resolve %q: %v", err.Path, err.Component, err.Err)
+}
+
+func (err *PathError) Unwrap() error {
+	return err.Err
+}
+
+// resolveSection looks up the section of a path in cfg.
+func (p Path) resolveSection(cfg *config) (*section, error) {
+	var sec *section
+	var err error
+	if strings.HasPrefix(p.Section, "@") {
+		sec, err = cfg.getUnnamed(p.Section)
+	} else {
+		sec = cfg.getNamed(p.Section)
+	}
+	if sec == nil && err == nil {
+		err = ErrSectionNotFound{Section: p.Section}
+	}
+	if err != nil {
+		return nil, &PathError{Path: p, Component: p.Section, Err: err}
+	}
+	return sec, nil
+}
+
+// check verifies, that p has (at least) the given number of segments.
+func (p Path) check(minLen int) error {
+	if p.Config == "" || (minLen > 1 && p.Section == "") || (minLen > 2 && p.Option == "") {
+		return fmt.Errorf("%w %q: too few components", ErrInvalidPath, p.String())
+	}
+	return nil
+}
+
+// A PathAccessor reads and modifies configs addressed by paths (see
+// ParsePath), like the uci command line tool does. Trees created by
+// NewTree implement it, and so do their wrappers (see ReadOnly and Fork),
+// if the wrapped tree does.
+type PathAccessor interface {
+	// GetPath retrieves the values of an option addressed by a path, or
+	// the type of a section, if the path has no option component. If any
+	// component cannot be resolved, a PathError is returned.
+	GetPath(p Path) ([]string, error)
+
+	// SetPath works like "uci set": for an option path, it replaces the
+	// option with the given values (a list, if more than one value is
+	// given); for a section path, it adds a named section with the given
+	// type, or changes the type of an existing section. Missing configs
+	// are created for the latter.
+	SetPath(p Path, values ...string) error
+
+	// AddPath works like "uci add_list": it appends values to a list,
+	// creating it if necessary. An option is converted into a list.
+	AddPath(p Path, values ...string) error
+
+	// DelPath works like "uci delete": it removes an option or a section.
+	DelPath(p Path) error
+}
+
+var _ PathAccessor = (*tree)(nil)
+
+func (t *tree) GetPath(p Path) ([]string, error) {
+	if err := p.check(2); err != nil {
+		return nil, err
+	}
+	schema := t.getSchema()
+	cfg, release, err := t.acquire(p.Config, false)
+	if err != nil {
+		return nil, &PathError{Path: p, Component: p.Config, Err: err}
+	}
+	defer release()
+
+	sec, err := p.resolveSection(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if p.Option == "" {
+		return []string{sec.Type}, nil
+	}
+	values, _ := schema.lookupValues(cfg, p.Section, p.Option)
+	if values == nil {
+		return nil, &PathError{Path: p, Component: p.Option, Err: ErrOptionNotFound{Option: p.Option}}
+	}
+	return values, nil
+}
+
+func (t *tree) SetPath(p Path, values ...string) error {
+	if err := p.check(2); err != nil {
+		return err
+	}
+	if p.Option == "" && len(values) != 1 {
+		return fmt.Errorf("%s: expected a single section type", p)
+	}
+	if len(values) == 0 {
+		return fmt.Errorf("%s: no values given", p)
+	}
+
+	schema := t.getSchema()
+	cfg, release, err := t.acquire(p.Config, true)
+	if errors.Is(err, os.ErrNotExist) && p.Option == "" {
+		cfg, release = t.create(p.Config)
+	} else if err != nil {
+		return &PathError{Path: p, Component: p.Config, Err: err}
+	}
+	defer release()
+
+	if p.Option == "" {
+		// create or retype section
+		if strings.HasPrefix(p.Section, "@") {
+			sec, err := p.resolveSection(cfg)
+			if err != nil {
+				return err
+			}
+			sec.Type = values[0]
+		} else if sec := cfg.getNamed(p.Section); sec != nil {
+			sec.Type = values[0]
+		} else {
+			cfg.Add(newSection(values[0], p.Section))
+		}
+		cfg.touch()
+		return nil
+	}
+
+	sec, err := p.resolveSection(cfg)
+	if err != nil {
+		return err
+	}
+	typ := TypeOption
+	if len(values) != 1 {
+		typ = TypeList
+	}
+	if err = schema.checkWrite(cfg, p.Section, p.Option, typ, values); err != nil {
+		return err
+	}
+	if opt := sec.Get(p.Option); opt != nil {
+		opt.Type = typ
+		opt.SetValues(values...)
+	} else {
+		sec.Add(newOption(p.Option, typ, values...))
+	}
+	cfg.touch()
+	return nil
+}
+
+func (t *tree) AddPath(p Path, values ...string) error {
+	if err := p.check(3); err != nil {
+		return err
+	}
+	if len(values) == 0 {
+		return fmt.Errorf("%s: no values given", p)
+	}
+	schema := t.getSchema()
+	cfg, release, err := t.acquire(p.Config, true)
+	if err != nil {
+		return &PathError{Path: p, Component: p.Config, Err: err}
+	}
+	defer release()
+
+	sec, err := p.resolveSection(cfg)
+	if err != nil {
+		return err
+	}
+	if err = schema.checkWrite(cfg, p.Section, p.Option, TypeList, values); err != nil {
+		return err
+	}
+	if opt := sec.Get(p.Option); opt != nil {
+		opt.Type = TypeList
+		for _, v := range values {
+			opt.AddValue(v)
+		}
+	} else {
+		sec.Add(newOption(p.Option, TypeList, values...))
+	}
+	cfg.touch()
+	return nil
+}
+
+func (t *tree) DelPath(p Path) error {
+	if err := p.check(2); err != nil {
+		return err
+	}
+	cfg, release, err := t.acquire(p.Config, true)
+	if err != nil {
+		return &PathError{Path: p, Component: p.Config, Err: err}
+	}
+	defer release()
+
+	sec, err := p.resolveSection(cfg)
+	if err != nil {
+		return err
+	}
+	if p.Option == "" {
+		cfg.remove(sec)
+	} else if !sec.Del(p.Option) {
+		return &PathError{Path: p, Component: p.Option, Err: ErrOptionNotFound{Option: p.Option}}
+	}
+	cfg.touch()
+	return nil
+}
@@ -0,0 +1,161 @@
+package uci
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePath(t *testing.T) {
+	assert := assert.New(t)
+
+	for s, expected := range map[string]Path{
+		"network":                    {Config: "network"},
+		"network.lan":                {Config: "network", Section: "lan"},
+		"network.lan.ipaddr":         {Config: "network", Section: "lan", Option: "ipaddr"},
+		"firewall.@zone[1].network":  {Config: "firewall", Section: "@zone[1]", Option: "network"},
+		"firewall.@zone[-1]":         {Config: "firewall", Section: "@zone[-1]"},
+		`network.'my.lan'."ip addr"`: {Config: "network", Section: "my.lan", Option: "ip addr"},
+		`network.my\.lan.ipaddr`:     {Config: "network", Section: "my.lan", Option: "ipaddr"},
+	} {
+		p, err := ParsePath(s)
+		assert.NoError(err, s)
+		assert.Equal(expected, p, s)
+	}
+
+	for _, s := range []string{
+		"",
+		"network.",
+		"network..ipaddr",
+		"a.b.c.d",
+		"network.'lan",
+		"firewall.@zone",
+		"firewall.@zone[x]",
+	} {
+		_, err := ParsePath(s)
+		assert.ErrorIs(err, ErrInvalidPath, s)
+	}
+
+	assert.Panics(func() { MustParsePath("a.b.c.d") })
+}
+
+func TestPathString(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, s := range []string{
+		"network",
+		"network.lan.ipaddr",
+		"firewall.@zone[1].network",
+		`network.'my.lan'.'it'\''s'`,
+	} {
+		assert.Equal(s, MustParsePath(s).String())
+	}
+}
+
+func TestPathMethods(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "firewall", `
+config zone
+	option name 'lan'
+	list network 'lan'
+
+config zone
+	option name 'wan'
+	list network 'wan'
+`)
+	r := NewTree(dir)
+	pa := r.(PathAccessor)
+
+	values, err := pa.GetPath(MustParsePath("firewall.@zone[1].network"))
+	assert.NoError(err)
+	assert.Equal([]string{"wan"}, values)
+	values, err = pa.GetPath(MustParsePath("firewall.@zone[-1]"))
+	assert.NoError(err)
+	assert.Equal([]string{"zone"}, values)
+
+	require.NoError(t, pa.AddPath(MustParsePath("firewall.@zone[1].network"), "wan6"))
+	values, _ = r.Get("firewall", "@zone[1]", "network")
+	assert.Equal([]string{"wan", "wan6"}, values)
+
+	require.NoError(t, pa.SetPath(MustParsePath("firewall.@zone[0].input"), "ACCEPT"))
+	require.NoError(t, pa.SetPath(MustParsePath("firewall.@zone[0].network"), "lan", "guest"))
+	require.NoError(t, pa.SetPath(MustParsePath("firewall.guest"), "zone"))
+	require.NoError(t, pa.SetPath(MustParsePath("firewall.guest.name"), "guest"))
+	require.NoError(t, pa.SetPath(MustParsePath("system.main"), "system"))
+	require.NoError(t, pa.DelPath(MustParsePath("firewall.@zone[1]")))
+	require.NoError(t, pa.DelPath(MustParsePath("firewall.@zone[0].input")))
+
+	sections, _ := r.GetSections("firewall", "zone")
+	assert.Equal([]string{"@zone[0]", "guest"}, sections)
+	values, _ = r.Get("firewall", "@zone[0]", "network")
+	assert.Equal([]string{"lan", "guest"}, values)
+	values, _ = r.Get("system", "main", "")
+	assert.Nil(values)
+}
+
+func TestPathErrors(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "firewall", "config zone 'lan'\n\toption input 'ACCEPT'\n")
+	r := NewTree(dir)
+	pa := r.(PathAccessor)
+
+	var perr *PathError
+	_, err := pa.GetPath(MustParsePath("missing.lan.proto"))
+	require.ErrorAs(t, err, &perr)
+	assert.Equal("missing", perr.Component)
+	assert.ErrorIs(err, os.ErrNotExist)
+
+	_, err = pa.GetPath(MustParsePath("firewall.wan.input"))
+	require.ErrorAs(t, err, &perr)
+	assert.Equal("wan", perr.Component)
+	assert.EqualError(err, `firewall.wan.input: cannot resolve "wan": section wan not found`)
+
+	_, err = pa.GetPath(MustParsePath("firewall.@zone[3].input"))
+	require.ErrorAs(t, err, &perr)
+	assert.Equal("@zone[3]", perr.Component)
+	assert.ErrorIs(err, ErrUnnamedIndexOutOfBounds)
+
+	_, err = pa.GetPath(MustParsePath("firewall.lan.output"))
+	require.ErrorAs(t, err, &perr)
+	assert.Equal("output", perr.Component)
+	assert.ErrorIs(err, ErrOptionNotFound{Option: "output"})
+
+	assert.ErrorAs(pa.SetPath(MustParsePath("firewall.wan.input"), "REJECT"), &perr)
+	assert.ErrorAs(pa.AddPath(MustParsePath("firewall.wan.network"), "wan"), &perr)
+	assert.ErrorAs(pa.DelPath(MustParsePath("firewall.lan.output")), &perr)
+	assert.ErrorAs(pa.SetPath(MustParsePath("missing.lan.proto"), "dhcp"), &perr)
+
+	// incomplete paths and missing values
+	_, err = pa.GetPath(MustParsePath("firewall"))
+	assert.ErrorIs(err, ErrInvalidPath)
+	assert.ErrorIs(pa.AddPath(MustParsePath("firewall.lan"), "x"), ErrInvalidPath)
+	assert.Error(pa.SetPath(MustParsePath("firewall.lan")))
+	assert.Error(pa.AddPath(MustParsePath("firewall.lan.network")))
+	assert.False(errors.As(pa.SetPath(MustParsePath("firewall.lan.input")), &perr))
+}
+
+func TestPathAccessor(t *testing.T) {
+	assert := assert.New(t)
+	r := NewTree(t.TempDir())
+
+	assert.Implements((*PathAccessor)(nil), r)
+	assert.Implements((*PathAccessor)(nil), ReadOnly(r))
+	assert.Implements((*PathAccessor)(nil), r.(Cloner).Clone())
+
+	// forks of trees without path support
+	f := &Fork{Tree: struct{ Tree }{r}}
+	p := MustParsePath("network.lan.proto")
+	var nsErr ErrNotSupported
+	_, err := f.GetPath(p)
+	assert.ErrorAs(err, &nsErr)
+	assert.Equal("GetPath", nsErr.Op)
+	assert.ErrorAs(f.SetPath(p, "dhcp"), &nsErr)
+	assert.ErrorAs(f.AddPath(p, "dhcp"), &nsErr)
+	assert.ErrorAs(f.DelPath(p), &nsErr)
+	assert.Equal("DelPath", nsErr.Op)
+}
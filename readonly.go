@@ -0,0 +1,190 @@
+package uci
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+)
+
+// readOnlyTree wraps a Tree and rejects all modifications.
+type readOnlyTree struct {
+	Tree
+}
+
+// NewReadOnlyTree constructs a read-only tree pointing to root. See
+// ReadOnly for details.
+func NewReadOnlyTree(root string) Tree {
+	return ReadOnly(NewTree(root))
+}
+
+// ReadOnly wraps t, so that all methods modifying configs (or reverting
+// their pending changes) return an ErrReadOnly, while Commit (and
+// CommitWithMessage) are guaranteed to be no-ops. Revert and the methods
+// changing the tree's settings (schema, history, validators, hooks and
+// file modes) are no-ops as well. Reading, (re-)loading, watching and
+// exporting configs (e.g. with Backup) still work.
+//
+// Changes made to t directly (bypassing the wrapper) are visible, but
+// cannot be committed (or reverted) through the wrapper.
+func ReadOnly(t Tree) Tree {
+	if ro, ok := t.(*readOnlyTree); ok {
+		return ro
+	}
+	return &readOnlyTree{t}
+}
+
+func (ro *readOnlyTree) Watch(ctx context.Context) (<-chan WatchEvent, error) {
+	return watchTree(ctx, ro.Tree)
+}
+
+func (*readOnlyTree) Commit(...string) error {
+	return nil
+}
+
+func (*readOnlyTree) SetSchema(*Schema) {}
+
+func (*readOnlyTree) SetHistory(*History) {}
+
+func (*readOnlyTree) AddValidator(string, Validator) {}
+
+func (*readOnlyTree) AddPreCommitHook(CommitHook) {}
+
+func (*readOnlyTree) AddPostCommitHook(CommitHook) {}
+
+func (*readOnlyTree) SetFileMode(string, os.FileMode) {}
+
+func (*readOnlyTree) Revert(...string) {}
+
+func (*readOnlyTree) RevertSection(string, string) error {
+	return ErrReadOnly{Op: "RevertSection"}
+}
+
+func (*readOnlyTree) RevertOption(string, string, string) error {
+	return ErrReadOnly{Op: "RevertOption"}
+}
+
+func (*readOnlyTree) CommitWithMessage(string, ...string) error {
+	return nil
+}
+
+func (*readOnlyTree) Apply(time.Duration, Clock) (*ApplySession, error) {
+	return nil, ErrReadOnly{Op: "Apply"}
+}
+
+func (ro *readOnlyTree) Backup(w io.Writer, configs ...string) error {
+	a, err := optional[Archiver](ro.Tree, "Backup")
+	if err != nil {
+		return err
+	}
+	return a.Backup(w, configs...)
+}
+
+func (*readOnlyTree) Restore(io.Reader) error {
+	return ErrReadOnly{Op: "Restore"}
+}
+
+func (*readOnlyTree) RestoreVersion(string, int) error {
+	return ErrReadOnly{Op: "RestoreVersion"}
+}
+
+func (*readOnlyTree) SetType(string, string, string, OptionType, ...string) error {
+	return ErrReadOnly{Op: "SetType"}
+}
+
+func (*readOnlyTree) Del(string, string, string) error {
+	return ErrReadOnly{Op: "Del"}
+}
+
+func (*readOnlyTree) AddSection(string, string, string) error {
+	return ErrReadOnly{Op: "AddSection"}
+}
+
+func (*readOnlyTree) DelSection(string, string) error {
+	return ErrReadOnly{Op: "DelSection"}
+}
+
+func (ro *readOnlyTree) DryRun(configs ...string) ([]FileDiff, error) {
+	dr, err := optional[DryRunner](ro.Tree, "DryRun")
+	if err != nil {
+		return nil, err
+	}
+	return dr.DryRun(configs...)
+}
+
+func (ro *readOnlyTree) GetPath(p Path) ([]string, error) {
+	pa, err := optional[PathAccessor](ro.Tree, "GetPath")
+	if err != nil {
+		return nil, err
+	}
+	return pa.GetPath(p)
+}
+
+func (*readOnlyTree) SetPath(Path, ...string) error {
+	return ErrReadOnly{Op: "SetPath"}
+}
+
+func (*readOnlyTree) AddPath(Path, ...string) error {
+	return ErrReadOnly{Op: "AddPath"}
+}
+
+func (*readOnlyTree) DelPath(Path) error {
+	return ErrReadOnly{Op: "DelPath"}
+}
+
+func (*readOnlyTree) Import(string, io.Reader, ImportMode) error {
+	return ErrReadOnly{Op: "Import"}
+}
+
+func (ro *readOnlyTree) ExportBatch(w io.Writer, configs ...string) error {
+	b, err := optional[Batcher](ro.Tree, "ExportBatch")
+	if err != nil {
+		return err
+	}
+	return b.ExportBatch(w, configs...)
+}
+
+func (*readOnlyTree) Batch(io.Reader) error {
+	return ErrReadOnly{Op: "Batch"}
+}
+
+// Clone returns a read-only fork, which cannot be merged. It returns nil,
+// if the wrapped tree does not implement Cloner.
+func (ro *readOnlyTree) Clone() *Fork {
+	c, err := optional[Cloner](ro.Tree, "Clone")
+	if err != nil {
+		return nil
+	}
+	f := c.Clone()
+	f.Tree = ReadOnly(f.Tree)
+	f.readOnly = true
+	return f
+}
+
+// Update calls fn with a transaction, which rejects all modifications.
+func (ro *readOnlyTree) Update(fn func(tx Tx) error) error {
+	return ro.Tree.Update(func(tx Tx) error {
+		return fn(readOnlyTx{tx})
+	})
+}
+
+// readOnlyTx wraps a Tx and rejects all modifications.
+type readOnlyTx struct {
+	Tx
+}
+
+func (readOnlyTx) SetType(string, string, string, OptionType, ...string) error {
+	return ErrReadOnly{Op: "SetType"}
+}
+
+func (readOnlyTx) Del(string, string, string) error {
+	return ErrReadOnly{Op: "Del"}
+}
+
+func (readOnlyTx) AddSection(string, string, string) error {
+	return ErrReadOnly{Op: "AddSection"}
+}
+
+func (readOnlyTx) DelSection(string, string) error {
+	return ErrReadOnly{Op: "DelSection"}
+}
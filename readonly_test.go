@@ -0,0 +1,116 @@
+package uci
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadOnly(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	const content = "config system\n\toption hostname 'OpenWrt'\n"
+	writeTestConfig(t, dir, "system", content)
+
+	r := NewReadOnlyTree(dir)
+	assert.Same(r, ReadOnly(r))
+
+	value, ok := r.GetLast("system", "@system[0]", "hostname")
+	assert.True(ok)
+	assert.Equal("OpenWrt", value)
+
+	var roErr ErrReadOnly
+	assert.ErrorAs(r.SetType("system", "@system[0]", "hostname", TypeOption, "foo"), &roErr)
+	assert.Equal("SetType", roErr.Op)
+	assert.EqualError(roErr, "SetType: tree is read-only")
+	assert.ErrorAs(r.Del("system", "@system[0]", "hostname"), &roErr)
+	assert.ErrorAs(r.AddSection("system", "foo", "bar"), &roErr)
+	assert.ErrorAs(r.DelSection("system", "@system[0]"), &roErr)
+	assert.ErrorAs(r.(Archiver).Restore(&bytes.Buffer{}), &roErr)
+	assert.ErrorAs(r.(HistoryKeeper).RestoreVersion("system", 1), &roErr)
+	assert.ErrorAs(r.(Batcher).Batch(&bytes.Buffer{}), &roErr)
+	assert.ErrorAs(r.(Importer).Import("system", &bytes.Buffer{}, ImportMerge), &roErr)
+	p := MustParsePath("system.@system[0].hostname")
+	assert.ErrorAs(r.(PathAccessor).SetPath(p, "foo"), &roErr)
+	assert.ErrorAs(r.(PathAccessor).AddPath(p, "foo"), &roErr)
+	assert.ErrorAs(r.(PathAccessor).DelPath(p), &roErr)
+	_, err := r.(Applier).Apply(time.Second, nil)
+	assert.ErrorAs(err, &roErr)
+	assert.ErrorAs(r.Update(func(tx Tx) error {
+		value, ok := tx.GetLast("system", "@system[0]", "hostname")
+		assert.True(ok)
+		assert.Equal("OpenWrt", value)
+		return tx.SetType("system", "@system[0]", "hostname", TypeOption, "foo")
+	}), &roErr)
+
+	// reloading works
+	writeTestConfig(t, dir, "system", "config system\n\toption hostname 'changed'\n")
+	require.NoError(t, r.LoadConfig("system", true))
+	value, _ = r.GetLast("system", "@system[0]", "hostname")
+	assert.Equal("changed", value)
+
+	var buf bytes.Buffer
+	assert.NoError(r.(Archiver).Backup(&buf))
+	assert.NotZero(buf.Len())
+}
+
+func TestReadOnly_commit(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	inner := NewTree(dir)
+	r := ReadOnly(inner)
+
+	// changes through the inner tree are visible, but cannot be
+	// committed through the wrapper
+	require.NoError(t, inner.AddSection("network", "lan", "interface"))
+	_, ok := r.Get("network", "lan", "proto")
+	assert.True(ok)
+
+	assert.NoError(r.Commit())
+	assert.NoError(r.(HistoryKeeper).CommitWithMessage("msg", "network"))
+	_, err := os.Stat(filepath.Join(dir, "network"))
+	assert.ErrorIs(err, os.ErrNotExist)
+}
+
+func TestReadOnly_wrappedTreeUnchanged(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "system", "config system 'main'\n\toption hostname 'OpenWrt'\n")
+	inner := NewTree(dir)
+	r := ReadOnly(inner)
+
+	// pending changes of the inner tree cannot be reverted
+	require.NoError(t, inner.SetType("system", "main", "hostname", TypeOption, "pending"))
+	var roErr ErrReadOnly
+	assert.ErrorAs(r.RevertSection("system", "main"), &roErr)
+	assert.Equal("RevertSection", roErr.Op)
+	assert.ErrorAs(r.RevertOption("system", "main", "hostname"), &roErr)
+	assert.Equal("RevertOption", roErr.Op)
+	r.Revert()
+	value, _ := inner.GetLast("system", "main", "hostname")
+	assert.Equal("pending", value)
+
+	// settings are not passed through
+	fail := func([]string) error { return errors.New("hook called") } //nolint:goerr113
+	r.SetSchema(&Schema{})
+	r.(HistoryKeeper).SetHistory(NewHistory(t.TempDir(), 0))
+	r.(ValidatorRegistrar).AddValidator("", func(ConfigView) error { return errors.New("validator called") }) //nolint:goerr113
+	r.(HookRegistrar).AddPreCommitHook(fail)
+	r.(HookRegistrar).AddPostCommitHook(fail)
+	r.(FileModeSetter).SetFileMode("network", 0o600)
+
+	x := inner.(*tree)
+	assert.Nil(x.schema)
+	assert.Nil(x.history)
+	assert.Empty(x.validators)
+	assert.Empty(x.preCommit)
+	assert.Empty(x.postCommit)
+	assert.Empty(x.fileModes)
+	assert.NoError(inner.Commit())
+}
@@ -0,0 +1,113 @@
+package uci
+
+import (
+	"errors"
+	"os"
+)
+
+func (t *tree) RevertSection(config, section string) error {
+	cfg, release, ok := t.lookup(config, true)
+	if !ok {
+		return nil // nothing to revert
+	}
+	defer release()
+
+	if !cfg.tainted {
+		return nil
+	}
+	base, err := t.committedConfig(config)
+	if err != nil {
+		return err
+	}
+
+	restoreSection(cfg, base, section)
+	cfg.touch()
+	cfg.tainted = !cfg.equal(base)
+	return nil
+}
+
+func (t *tree) RevertOption(config, section, option string) error {
+	cfg, release, ok := t.lookup(config, true)
+	if !ok {
+		return nil // nothing to revert
+	}
+	defer release()
+
+	if !cfg.tainted {
+		return nil
+	}
+	base, err := t.committedConfig(config)
+	if err != nil {
+		return err
+	}
+
+	if err = restoreOption(cfg, base, section, option); err != nil {
+		return err
+	}
+	cfg.touch()
+	cfg.tainted = !cfg.equal(base)
+	return nil
+}
+
+// committedConfig reads the on-disk version of a config. A missing file
+// yields an empty config.
+func (t *tree) committedConfig(name string) (*config, error) {
+	cfg, err := t.readConfig(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return newConfig(name), nil
+	}
+	return cfg, err
+}
+
+// restoreSection replaces a section in cfg with a copy of its counterpart
+// in base. If base lacks that section, it is removed from cfg. Unnamed
+// sections are matched by their synthetic name (e.g. "@rule[2]").
+func restoreSection(cfg, base *config, name string) {
+	cur, orig := cfg.Get(name), base.Get(name)
+	if orig == nil {
+		if cur != nil {
+			cfg.remove(cur)
+		}
+		return
+	}
+
+	pos := -1
+	if cur != nil {
+		pos = cfg.remove(cur)
+	} else {
+		for i, sec := range base.Sections {
+			if sec == orig {
+				pos = i
+				break
+			}
+		}
+	}
+	cfg.insert(pos, orig.clone())
+}
+
+// restoreOption replaces an option in cfg with a copy of its counterpart
+// in base. If base lacks that option (or the whole section), it is
+// removed from cfg.
+func restoreOption(cfg, base *config, section, name string) error {
+	cur := cfg.Get(section)
+	if cur == nil {
+		return ErrSectionNotFound{Section: section}
+	}
+
+	var orig *option
+	if sec := base.Get(section); sec != nil {
+		orig = sec.Get(name)
+	}
+	if orig == nil {
+		cur.Del(name)
+		return nil
+	}
+
+	if opt := cur.Get(name); opt != nil {
+		opt.Type = orig.Type
+		opt.SetValues(append([]string(nil), orig.Values...)...)
+	} else {
+		cur.Add(orig.clone())
+	}
+	return nil
+}
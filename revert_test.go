@@ -0,0 +1,92 @@
+package uci
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const tcRevertInput = `
+config interface 'lan'
+	option ipaddr '192.168.1.1'
+	option netmask '255.255.255.0'
+
+config interface 'wan'
+	option proto 'dhcp'
+
+config rule
+	option name 'first'
+`
+
+func TestRevertSection(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "network", tcRevertInput)
+	r := NewTree(dir)
+
+	// not loaded, nothing to do
+	assert.NoError(r.RevertSection("network", "lan"))
+
+	require.NoError(t, r.SetType("network", "lan", "ipaddr", TypeOption, "10.0.0.1"))
+	require.NoError(t, r.SetType("network", "wan", "proto", TypeOption, "static"))
+	require.NoError(t, r.AddSection("network", "guest", "interface"))
+
+	assert.NoError(r.RevertSection("network", "lan"))
+	value, _ := r.GetLast("network", "lan", "ipaddr")
+	assert.Equal("192.168.1.1", value)
+	value, _ = r.GetLast("network", "wan", "proto")
+	assert.Equal("static", value)
+	assert.True(r.(*tree).configs["network"].tainted)
+
+	// sections missing on disk are removed
+	assert.NoError(r.RevertSection("network", "guest"))
+	names, _ := r.GetSections("network", "interface")
+	assert.Equal([]string{"lan", "wan"}, names)
+
+	// deleted sections are restored at their original position
+	require.NoError(t, r.DelSection("network", "lan"))
+	assert.NoError(r.RevertSection("network", "lan"))
+	names, _ = r.GetSections("network", "interface")
+	assert.Equal([]string{"lan", "wan"}, names)
+
+	// last pending change reverted
+	assert.NoError(r.RevertSection("network", "wan"))
+	assert.False(r.(*tree).configs["network"].tainted)
+}
+
+func TestRevertOption(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "network", tcRevertInput)
+	r := NewTree(dir)
+
+	require.NoError(t, r.SetType("network", "lan", "ipaddr", TypeOption, "10.0.0.1"))
+	require.NoError(t, r.Del("network", "lan", "netmask"))
+	require.NoError(t, r.SetType("network", "lan", "dns", TypeList, "1.1.1.1", "9.9.9.9"))
+	require.NoError(t, r.SetType("network", "@rule[0]", "name", TypeOption, "renamed"))
+
+	assert.NoError(r.RevertOption("network", "lan", "netmask"))
+	value, _ := r.GetLast("network", "lan", "netmask")
+	assert.Equal("255.255.255.0", value)
+
+	assert.NoError(r.RevertOption("network", "lan", "dns"))
+	_, ok := r.GetLast("network", "lan", "dns")
+	assert.False(ok)
+
+	assert.NoError(r.RevertOption("network", "@rule[0]", "name"))
+	value, _ = r.GetLast("network", "@rule[0]", "name")
+	assert.Equal("first", value)
+
+	// ipaddr is still pending
+	value, _ = r.GetLast("network", "lan", "ipaddr")
+	assert.Equal("10.0.0.1", value)
+	assert.True(r.(*tree).configs["network"].tainted)
+
+	assert.NoError(r.RevertOption("network", "lan", "ipaddr"))
+	assert.False(r.(*tree).configs["network"].tainted)
+
+	require.NoError(t, r.SetType("network", "lan", "ipaddr", TypeOption, "10.0.0.1"))
+	err := r.RevertOption("network", "nonexistent", "foo")
+	assert.ErrorAs(err, &ErrSectionNotFound{})
+}
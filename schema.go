@@ -0,0 +1,369 @@
+package uci
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// ErrInvalidSchema is returned by Schema.Check (and ReadSchema) for
+// inconsistent schemas.
+var ErrInvalidSchema = errors.New("invalid schema")
+
+// Datatype names the type of option values. The names follow OpenWrt's
+// validation datatypes.
+type Datatype string
+
+const (
+	DatatypeString   Datatype = "string"   // any value (the default)
+	DatatypeBool     Datatype = "bool"     // a value accepted by GetBool
+	DatatypeInteger  Datatype = "integer"  // a decimal integer
+	DatatypeUinteger Datatype = "uinteger" // a non-negative decimal integer
+	DatatypePort     Datatype = "port"     // an integer from 0 to 65535
+	DatatypeIPAddr   Datatype = "ipaddr"   // an IPv4 or IPv6 address
+	DatatypeIP4Addr  Datatype = "ip4addr"  // an IPv4 address
+	DatatypeIP6Addr  Datatype = "ip6addr"  // an IPv6 address
+	DatatypeCIDR     Datatype = "cidr"     // an address with prefix length
+	DatatypeMACAddr  Datatype = "macaddr"  // a MAC address
+	DatatypeHostname Datatype = "hostname" // a DNS host name
+)
+
+var hostnameRe = regexp.MustCompile(`^[a-zA-Z0-9_]([a-zA-Z0-9_-]{0,62})(\.[a-zA-Z0-9_]([a-zA-Z0-9_-]{0,62}))*\.?$`)
+
+// valid reports whether v is a valid value of the datatype. The empty
+// datatype is treated as DatatypeString.
+func (dt Datatype) valid(v string) bool {
+	switch dt {
+	case "", DatatypeString:
+		return true
+	case DatatypeBool:
+		_, ok := parseBool(v)
+		return ok
+	case DatatypeInteger:
+		_, err := strconv.ParseInt(v, 10, 64)
+		return err == nil
+	case DatatypeUinteger:
+		_, err := strconv.ParseUint(v, 10, 64)
+		return err == nil
+	case DatatypePort:
+		_, err := strconv.ParseUint(v, 10, 16)
+		return err == nil
+	case DatatypeIPAddr:
+		return net.ParseIP(v) != nil
+	case DatatypeIP4Addr:
+		ip := net.ParseIP(v)
+		return ip != nil && ip.To4() != nil
+	case DatatypeIP6Addr:
+		ip := net.ParseIP(v)
+		return ip != nil && ip.To4() == nil
+	case DatatypeCIDR:
+		_, _, err := net.ParseCIDR(v)
+		return err == nil
+	case DatatypeMACAddr:
+		hw, err := net.ParseMAC(v)
+		return err == nil && len(hw) == 6
+	case DatatypeHostname:
+		return len(v) <= 253 && hostnameRe.MatchString(v)
+	}
+	return false
+}
+
+func (dt Datatype) known() bool {
+	switch dt {
+	case "", DatatypeString, DatatypeBool, DatatypeInteger, DatatypeUinteger,
+		DatatypePort, DatatypeIPAddr, DatatypeIP4Addr, DatatypeIP6Addr,
+		DatatypeCIDR, DatatypeMACAddr, DatatypeHostname:
+		return true
+	}
+	return false
+}
+
+// A Schema describes the section types and options of some configs. It
+// can be constructed in Go, or loaded from JSON (see ReadSchema):
+//
+//	{"network":{
+//	  "interface":{"options":{
+//	    "proto":{"required":true},
+//	    "ipaddr":{"type":"ip4addr"},
+//	    "dns":{"type":"ipaddr","list":true},
+//	    "device":{"deprecated":["ifname"]},
+//	    "auto":{"type":"bool","default":["1"]}
+//	  }}
+//	}}
+//
+// Configs and section types missing in the schema are not restricted. A
+// schema must not be modified after passing it to Tree.SetSchema.
+type Schema struct {
+	// Configs maps config names to section types to their schemas.
+	Configs map[string]map[string]*SectionSchema
+}
+
+// SectionSchema describes the options of a section type. Other options
+// are not allowed in sections of this type.
+type SectionSchema struct {
+	Options map[string]*OptionSchema `json:"options"`
+}
+
+// OptionSchema describes an option.
+type OptionSchema struct {
+	// Type is the datatype of the values, DatatypeString if empty.
+	Type Datatype `json:"type,omitempty"`
+
+	// List declares the option as list. A list may also be given as
+	// (single-valued) option, like in uci, but not vice versa.
+	List bool `json:"list,omitempty"`
+
+	// Required options must be present in each section of the type.
+	Required bool `json:"required,omitempty"`
+
+	// Default holds the values returned by Tree.Get, if the option is
+	// missing.
+	Default []string `json:"default,omitempty"`
+
+	// Deprecated lists former names of the option. Reads of the option
+	// fall back to these, while writes using them are rejected.
+	Deprecated []string `json:"deprecated,omitempty"`
+}
+
+// MarshalJSON implements encoding/json.Marshaler.
+func (s *Schema) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.Configs)
+}
+
+// UnmarshalJSON implements encoding/json.Unmarshaler.
+func (s *Schema) UnmarshalJSON(b []byte) error {
+	return json.Unmarshal(b, &s.Configs)
+}
+
+// ReadSchema reads a schema in JSON format from r, and checks it (see
+// Schema.Check).
+func ReadSchema(r io.Reader) (*Schema, error) {
+	s := &Schema{}
+	if err := json.NewDecoder(r).Decode(s); err != nil {
+		return nil, fmt.Errorf("schema: %w", err)
+	}
+	if err := s.Check(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Check verifies the consistency of the schema: datatypes must be known,
+// defaults must match the option, and deprecated names must not clash
+// with other options.
+func (s *Schema) Check() error {
+	var errs []error
+	for _, config := range sortedKeys(s.Configs) {
+		for _, typ := range sortedKeys(s.Configs[config]) {
+			sec := s.Configs[config][typ]
+			if sec == nil {
+				continue
+			}
+			former := make(map[string]string)
+			for _, name := range sortedKeys(sec.Options) {
+				opt := sec.Options[name]
+				if opt == nil {
+					continue
+				}
+				ref := fmt.Sprintf("%s.@%s.%s", config, typ, name)
+				if !opt.Type.known() {
+					errs = append(errs, fmt.Errorf("%w: %s: unknown datatype %q", ErrInvalidSchema, ref, opt.Type))
+				}
+				if len(opt.Default) > 1 && !opt.List {
+					errs = append(errs, fmt.Errorf("%w: %s: multiple default values", ErrInvalidSchema, ref))
+				}
+				for _, v := range opt.Default {
+					if !opt.Type.valid(v) {
+						errs = append(errs, fmt.Errorf("%w: %s: invalid default %q", ErrInvalidSchema, ref, v))
+					}
+				}
+				for _, old := range opt.Deprecated {
+					if _, ok := sec.Options[old]; ok {
+						errs = append(errs, fmt.Errorf("%w: %s: deprecated name %q is an option", ErrInvalidSchema, ref, old))
+					} else if other, ok := former[old]; ok {
+						errs = append(errs, fmt.Errorf("%w: %s: deprecated name %q used by %s", ErrInvalidSchema, ref, old, other))
+					}
+					former[old] = name
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// section returns the schema of a section type, or nil. It accepts a nil
+// receiver.
+func (s *Schema) section(config, typ string) *SectionSchema {
+	if s == nil {
+		return nil
+	}
+	return s.Configs[config][typ]
+}
+
+// replacement returns the name of the option, which replaces the given
+// deprecated name, or "".
+func (sec *SectionSchema) replacement(name string) string {
+	for _, n := range sortedKeys(sec.Options) {
+		if opt := sec.Options[n]; opt != nil {
+			for _, old := range opt.Deprecated {
+				if old == name {
+					return n
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// lookupValues works like config.lookupValues, but falls back to
+// deprecated names and defaults of a missing option. It accepts a nil
+// receiver.
+func (s *Schema) lookupValues(cfg *config, section, option string) ([]string, bool) {
+	sec := cfg.Get(section)
+	if sec == nil {
+		return nil, false
+	}
+	if opt := sec.Get(option); opt != nil {
+		return append([]string(nil), opt.Values...), true
+	}
+
+	if ss := s.section(cfg.Name, sec.Type); ss != nil {
+		if spec := ss.Options[option]; spec != nil {
+			for _, old := range spec.Deprecated {
+				if opt := sec.Get(old); opt != nil {
+					return append([]string(nil), opt.Values...), true
+				}
+			}
+			if len(spec.Default) > 0 {
+				return append([]string(nil), spec.Default...), true
+			}
+		}
+	}
+	return nil, true
+}
+
+// checkOption checks a single option, and records problems in verr. If
+// write is true, deprecated names are reported as well.
+func (sec *SectionSchema) checkOption(verr *ValidationError, section string, opt *option, write bool) {
+	spec := sec.Options[opt.Name]
+	if spec == nil {
+		repl := sec.replacement(opt.Name)
+		switch {
+		case repl == "":
+			verr.Add(section, opt.Name, "unknown option")
+			return
+		case write:
+			verr.Add(section, opt.Name, "deprecated option, use %s", repl)
+			return
+		}
+		spec = sec.Options[repl]
+	}
+
+	if !spec.List && (opt.Type == TypeList || len(opt.Values) != 1) {
+		verr.Add(section, opt.Name, "expected option, got list")
+	}
+	for _, v := range opt.Values {
+		if !spec.Type.valid(v) {
+			verr.Add(section, opt.Name, "invalid %s value %q", datatypeName(spec.Type), v)
+		}
+	}
+}
+
+func datatypeName(dt Datatype) string {
+	if dt == "" {
+		return string(DatatypeString)
+	}
+	return string(dt)
+}
+
+// checkWrite verifies, that setting an option is allowed by the schema.
+// It returns a ValidationError, or nil. It accepts a nil receiver.
+func (s *Schema) checkWrite(cfg *config, section, option string, typ OptionType, values []string) error {
+	sec := cfg.Get(section)
+	if sec == nil {
+		return nil // reported elsewhere
+	}
+	ss := s.section(cfg.Name, sec.Type)
+	if ss == nil {
+		return nil
+	}
+	verr := ValidationError{Config: cfg.Name}
+	ss.checkOption(&verr, cfg.sectionName(sec), newOption(option, typ, values...), true)
+	return verr.Err()
+}
+
+// checkImport verifies, that writing the options of a config snippet
+// (see Importer.Import) is allowed by the schema, like checkWrite does for
+// single options. It accepts a nil receiver.
+func (s *Schema) checkImport(src *config) error {
+	verr := ValidationError{Config: src.Name}
+	for _, sec := range src.Sections {
+		ss := s.section(src.Name, sec.Type)
+		if ss == nil {
+			continue
+		}
+		name := src.sectionName(sec)
+		for _, opt := range sec.Options {
+			ss.checkOption(&verr, name, opt, true)
+		}
+	}
+	return verr.Err()
+}
+
+// validate checks a config against the schema. It reports unknown,
+// missing and mistyped options. It accepts a nil receiver.
+func (s *Schema) validate(cfg *config) error {
+	verr := ValidationError{Config: cfg.Name}
+	for _, sec := range cfg.Sections {
+		ss := s.section(cfg.Name, sec.Type)
+		if ss == nil {
+			continue
+		}
+		name := cfg.sectionName(sec)
+		for _, opt := range sec.Options {
+			ss.checkOption(&verr, name, opt, false)
+		}
+		for _, optName := range sortedKeys(ss.Options) {
+			spec := ss.Options[optName]
+			if spec == nil || !spec.Required || sec.Get(optName) != nil {
+				continue
+			}
+			found := false
+			for _, old := range spec.Deprecated {
+				found = found || sec.Get(old) != nil
+			}
+			if !found {
+				verr.Add(name, optName, "required option missing")
+			}
+		}
+	}
+	return verr.Err()
+}
+
+func (t *tree) SetSchema(s *Schema) {
+	t.mu.Lock()
+	t.schema = s
+	t.mu.Unlock()
+}
+
+// getSchema returns the tree's schema. It must be called without holding
+// any lock.
+func (t *tree) getSchema() *Schema {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.schema
+}
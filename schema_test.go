@@ -0,0 +1,249 @@
+package uci
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const schemaTestJSON = `{"network":{
+	"interface":{"options":{
+		"proto":{"required":true},
+		"ipaddr":{"type":"ip4addr"},
+		"dns":{"type":"ipaddr","list":true},
+		"device":{"deprecated":["ifname"]},
+		"auto":{"type":"bool","default":["1"]}
+	}}
+}}`
+
+func testSchema(t *testing.T) *Schema {
+	t.Helper()
+	s, err := ReadSchema(strings.NewReader(schemaTestJSON))
+	require.NoError(t, err)
+	return s
+}
+
+func TestReadSchema(t *testing.T) {
+	assert := assert.New(t)
+	s := testSchema(t)
+
+	expected := &Schema{Configs: map[string]map[string]*SectionSchema{
+		"network": {"interface": {Options: map[string]*OptionSchema{
+			"proto":  {Required: true},
+			"ipaddr": {Type: DatatypeIP4Addr},
+			"dns":    {Type: DatatypeIPAddr, List: true},
+			"device": {Deprecated: []string{"ifname"}},
+			"auto":   {Type: DatatypeBool, Default: []string{"1"}},
+		}}},
+	}}
+	assert.Equal(expected, s)
+	assert.NoError(expected.Check())
+
+	_, err := ReadSchema(strings.NewReader(`{"network":[]}`))
+	assert.Error(err)
+}
+
+func TestSchemaCheck(t *testing.T) {
+	for _, opts := range []map[string]*OptionSchema{
+		{"a": {Type: "color"}},
+		{"a": {Type: DatatypePort, Default: []string{"http"}}},
+		{"a": {Default: []string{"x", "y"}}},
+		{"a": {Deprecated: []string{"b"}}, "b": {}},
+		{"a": {Deprecated: []string{"c"}}, "b": {Deprecated: []string{"c"}}},
+	} {
+		s := &Schema{Configs: map[string]map[string]*SectionSchema{
+			"test": {"section": {Options: opts}},
+		}}
+		assert.ErrorIs(t, s.Check(), ErrInvalidSchema)
+	}
+}
+
+func TestDatatypes(t *testing.T) {
+	assert := assert.New(t)
+	for dt, values := range map[Datatype][2][]string{
+		DatatypeString:   {{"", "foo"}, nil},
+		DatatypeBool:     {{"1", "off", "enabled"}, {"", "maybe"}},
+		DatatypeInteger:  {{"-1", "42"}, {"", "1.5", "x"}},
+		DatatypeUinteger: {{"0", "42"}, {"-1"}},
+		DatatypePort:     {{"0", "65535"}, {"65536", "-1"}},
+		DatatypeIPAddr:   {{"10.0.0.1", "fe80::1"}, {"10.0.0", "10.0.0.1/24"}},
+		DatatypeIP4Addr:  {{"10.0.0.1"}, {"fe80::1"}},
+		DatatypeIP6Addr:  {{"fe80::1", "::1"}, {"10.0.0.1"}},
+		DatatypeCIDR:     {{"10.0.0.0/8", "fd00::/64"}, {"10.0.0.1"}},
+		DatatypeMACAddr:  {{"00:11:22:aa:bb:cc"}, {"00:11:22:aa:bb", "00:00:00:00:fe:80:00:00"}},
+		DatatypeHostname: {{"openwrt", "router.lan", "example.com."}, {"", "-foo", "foo..bar"}},
+		"unknown":        {nil, {"foo"}},
+	} {
+		for _, v := range values[0] {
+			assert.True(dt.valid(v), "%s %q", dt, v)
+		}
+		for _, v := range values[1] {
+			assert.False(dt.valid(v), "%s %q", dt, v)
+		}
+	}
+}
+
+const schemaTestConfig = `
+config interface 'lan'
+	option proto 'static'
+	option ifname 'eth0'
+
+config interface 'wan'
+	option auto '0'
+
+config rule
+	option anything 'goes'
+`
+
+func TestTreeSchema_read(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "network", schemaTestConfig)
+	r := NewTree(dir)
+	r.SetSchema(testSchema(t))
+
+	// defaults
+	enabled, ok := r.GetBool("network", "lan", "auto")
+	assert.True(ok)
+	assert.True(enabled)
+	enabled, ok = r.GetBool("network", "wan", "auto")
+	assert.True(ok)
+	assert.False(enabled)
+
+	// deprecated names
+	value, ok := r.GetLast("network", "lan", "device")
+	assert.True(ok)
+	assert.Equal("eth0", value)
+	values, err := r.(PathAccessor).GetPath(MustParsePath("network.lan.device"))
+	assert.NoError(err)
+	assert.Equal([]string{"eth0"}, values)
+
+	require.NoError(t, r.Update(func(tx Tx) error {
+		value, _ := tx.GetLast("network", "wan", "auto")
+		assert.Equal("0", value)
+		value, _ = tx.GetLast("network", "lan", "auto")
+		assert.Equal("1", value)
+		return nil
+	}))
+
+	// missing options without default
+	values, ok = r.Get("network", "lan", "ipaddr")
+	assert.True(ok)
+	assert.Nil(values)
+
+	// snapshots keep the schema of the tree
+	s, err := r.Snapshot("network")
+	require.NoError(t, err)
+	value, _ = s.GetLast("network", "lan", "device")
+	assert.Equal("eth0", value)
+
+	r.SetSchema(nil)
+	_, ok = r.GetLast("network", "lan", "auto")
+	assert.False(ok)
+	enabled, ok = s.GetBool("network", "lan", "auto")
+	assert.True(ok)
+	assert.True(enabled)
+}
+
+func TestTreeSchema_write(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "network", schemaTestConfig)
+	r := NewTree(dir)
+	r.SetSchema(testSchema(t))
+
+	assert.NoError(r.SetType("network", "lan", "ipaddr", TypeOption, "192.168.1.1"))
+	assert.NoError(r.SetType("network", "lan", "dns", TypeList, "1.1.1.1", "fe80::1"))
+	assert.NoError(r.SetType("network", "@rule[0]", "foo", TypeList, "bar"))
+
+	var verr ValidationError
+	for _, err := range []error{
+		r.SetType("network", "lan", "ipaddr", TypeOption, "fe80::1"),
+		r.SetType("network", "lan", "ipaddr", TypeList, "10.0.0.1", "10.0.0.2"),
+		r.SetType("network", "lan", "mtu", TypeOption, "1500"),
+		r.SetType("network", "lan", "ifname", TypeOption, "eth1"),
+		r.(PathAccessor).SetPath(MustParsePath("network.lan.auto"), "perhaps"),
+		r.(PathAccessor).AddPath(MustParsePath("network.lan.proto"), "dhcp"),
+		r.Update(func(tx Tx) error {
+			return tx.SetType("network", "wan", "dns", TypeList, "dns.google")
+		}),
+	} {
+		require.ErrorAs(t, err, &verr)
+		assert.Equal("network", verr.Config)
+		assert.Len(verr.Problems, 1)
+	}
+	assert.EqualError(r.SetType("network", "lan", "ifname", TypeOption, "eth1"),
+		"validation of network failed: lan.ifname: deprecated option, use device")
+
+	// nothing was written
+	value, _ := r.GetLast("network", "lan", "ipaddr")
+	assert.Equal("192.168.1.1", value)
+}
+
+func TestTreeSchema_commit(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "network", schemaTestConfig)
+	r := NewTree(dir)
+
+	// changes made before setting the schema are validated on commit
+	require.NoError(t, r.SetType("network", "lan", "mtu", TypeOption, "1500"))
+	require.NoError(t, r.SetType("network", "wan", "ipaddr", TypeOption, "x"))
+	r.SetSchema(testSchema(t))
+	err := r.Commit()
+	var verr ValidationError
+	require.ErrorAs(t, err, &verr)
+	assert.Equal([]Problem{
+		{Section: "lan", Option: "mtu", Message: "unknown option"},
+		{Section: "wan", Option: "ipaddr", Message: `invalid ip4addr value "x"`},
+		{Section: "wan", Option: "proto", Message: "required option missing"},
+	}, verr.Problems)
+
+	r.Revert("network")
+	require.NoError(t, r.SetType("network", "wan", "proto", TypeOption, "dhcp"))
+	assert.NoError(r.Commit())
+
+	// the schema is kept by clones
+	f := r.(Cloner).Clone()
+	assert.Error(f.SetType("network", "wan", "mtu", TypeOption, "1500"))
+}
+
+func TestTreeSchema_batchImport(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "network", schemaTestConfig)
+	r := NewTree(dir)
+	r.SetSchema(testSchema(t))
+
+	for script, problem := range map[string]Problem{
+		"set network.lan.ipaddr='10.0.0.1'\nset network.lan.mtu='1500'\n":     {Section: "lan", Option: "mtu", Message: "unknown option"},
+		"add_list network.wan.dns='dns.google'\n":                             {Section: "wan", Option: "dns", Message: `invalid ipaddr value "dns.google"`},
+		"set network.wan.device='eth1'\nrename network.wan.device='ifname'\n": {Section: "wan", Option: "ifname", Message: "deprecated option, use device"},
+	} {
+		var verr ValidationError
+		if assert.ErrorAs(r.(Batcher).Batch(strings.NewReader(script)), &verr, script) {
+			assert.Equal([]Problem{problem}, verr.Problems, script)
+		}
+	}
+
+	for snippet, problem := range map[string]Problem{
+		"config interface 'lan'\n\toption mtu '1500'\n":      {Section: "lan", Option: "mtu", Message: "unknown option"},
+		"config interface 'wan'\n\tlist dns 'dns.google'\n":  {Section: "wan", Option: "dns", Message: `invalid ipaddr value "dns.google"`},
+		"config interface 'guest'\n\toption ifname 'eth2'\n": {Section: "guest", Option: "ifname", Message: "deprecated option, use device"},
+	} {
+		for _, mode := range []ImportMode{ImportMerge, ImportReplace} {
+			var verr ValidationError
+			if assert.ErrorAs(r.(Importer).Import("network", strings.NewReader(snippet), mode), &verr, snippet) {
+				assert.Equal([]Problem{problem}, verr.Problems, snippet)
+			}
+		}
+	}
+
+	// nothing was written
+	values, _ := r.Get("network", "lan", "ipaddr")
+	assert.Nil(values)
+	sections, _ := r.GetSections("network", "interface")
+	assert.Equal([]string{"lan", "wan"}, sections)
+}
@@ -0,0 +1,209 @@
+package uci
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var errShowSyntax = errors.New("expected config.section=type or config.section.option=value")
+
+// ShowOptions controls WriteShow.
+type ShowOptions struct {
+	// Anonymous names unnamed sections with the IDs libuci generates
+	// (e.g. "cfg02dc81") instead of their synthetic names (e.g.
+	// "@zone[0]"), like "uci show -X" does. An ID consists of the
+	// section's position within the config (counting all sections from
+	// 1) and a hash of the section type.
+	Anonymous bool
+}
+
+// WriteShow writes the given configs (or all configs in the snapshot, if
+// none are given) to w in the format of "uci show":
+//
+//	network.lan=interface
+//	network.lan.ipaddr='192.168.1.1'
+//	network.lan.dns='1.1.1.1' '8.8.8.8'
+//
+// A config missing in the snapshot is skipped.
+func WriteShow(w io.Writer, s *TreeSnapshot, opts ShowOptions, configs ...string) error {
+	if len(configs) == 0 {
+		configs = s.Configs()
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, name := range configs {
+		cfg, ok := s.configs[name]
+		if !ok {
+			continue
+		}
+		for i, sec := range cfg.Sections {
+			prefix := cfg.Name + "." + cfg.sectionName(sec)
+			if sec.Name == "" && opts.Anonymous {
+				prefix = cfg.Name + "." + anonymousName(i+1, sec.Type)
+			}
+			fmt.Fprintf(bw, "%s=%s\n", prefix, sec.Type)
+			for _, opt := range sec.Options {
+				values := make([]string, len(opt.Values))
+				for j, v := range opt.Values {
+					values[j] = quoteBatch(v)
+				}
+				fmt.Fprintf(bw, "%s.%s=%s\n", prefix, opt.Name, strings.Join(values, " "))
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// anonymousName generates the ID of an unnamed section of the given type
+// at position n (counting all sections of the config from 1), like
+// libuci does: n is followed by the lower 16 bits of a djb2 hash of the
+// type.
+func anonymousName(n int, typ string) string {
+	hash := uint32(5381)
+	for i := 0; i < len(typ); i++ {
+		hash = hash*33 + uint32(typ[i])
+	}
+	hash &= 0x7fffffff
+	return fmt.Sprintf("cfg%02x%04x", n, hash%0x10000)
+}
+
+// anonymousNameRe matches IDs generated by anonymousName (or uci).
+var anonymousNameRe = regexp.MustCompile(`^cfg[0-9a-f]{6,}$`)
+
+// NewShowTree creates an in-memory tree from the output of "uci show"
+// (with or without -X). Sections with generated IDs (see ShowOptions) are
+// read as unnamed sections. Options with more than one value are read as
+// lists; a list with a single value cannot be distinguished from an
+// option, and is read as option.
+//
+// The tree behaves like a tree created by NewArchiveTree: it can be read
+// and modified, but not committed.
+func NewShowTree(r io.Reader) (Tree, error) {
+	configs, err := readShow(r)
+	if err != nil {
+		return nil, err
+	}
+	return newMemoryTree(configs)
+}
+
+// newMemoryTree creates an archive tree with the given configs loaded.
+// The configs are kept loaded, the rendered files only serve as baseline
+// (e.g. for DryRun).
+func newMemoryTree(configs map[string]*config) (Tree, error) {
+	files := make(map[string][]byte, len(configs))
+	for _, cfg := range configs {
+		var buf bytes.Buffer
+		if _, err := cfg.WriteTo(&buf); err != nil {
+			return nil, err
+		}
+		files[cfg.Name] = buf.Bytes()
+	}
+	return &archiveTree{&tree{
+		configs: configs,
+		archive: files,
+	}}, nil
+}
+
+// readShow parses the output of "uci show".
+func readShow(r io.Reader) (map[string]*config, error) {
+	configs := make(map[string]*config)
+	aliases := make(map[string]*section) // "config.cfgXXXXXX" => section
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if err := readShowLine(configs, aliases, line); err != nil {
+			return nil, fmt.Errorf("show: line %d: %w", n, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return configs, nil
+}
+
+func readShowLine(configs map[string]*config, aliases map[string]*section, line string) error {
+	i := strings.IndexByte(line, '=')
+	if i < 0 {
+		return errShowSyntax
+	}
+	values, err := splitBatchLine(line[i+1:])
+	if err != nil {
+		return err
+	}
+	parts := strings.Split(line[:i], ".")
+	for _, p := range parts {
+		if p == "" {
+			return errShowSyntax
+		}
+	}
+
+	switch len(parts) {
+	case 2:
+		if len(values) != 1 {
+			return errShowSyntax
+		}
+		cfg, ok := configs[parts[0]]
+		if !ok {
+			cfg = newConfig(parts[0])
+			configs[cfg.Name] = cfg
+		}
+		return addShowSection(cfg, aliases, parts[1], values[0])
+
+	case 3:
+		if len(values) == 0 {
+			return errShowSyntax
+		}
+		sec := aliases[parts[0]+"."+parts[1]]
+		if cfg, ok := configs[parts[0]]; ok && sec == nil {
+			sec = cfg.Get(parts[1])
+		}
+		if sec == nil {
+			return ErrSectionNotFound{Section: parts[0] + "." + parts[1]}
+		}
+		typ := TypeOption
+		if len(values) != 1 {
+			typ = TypeList
+		}
+		sec.Merge(newOption(parts[2], typ, values...))
+		return nil
+	}
+	return errShowSyntax
+}
+
+// addShowSection adds a section declared by "config.name=type".
+func addShowSection(cfg *config, aliases map[string]*section, name, typ string) error {
+	switch {
+	case anonymousNameRe.MatchString(name):
+		aliases[cfg.Name+"."+name] = cfg.Add(newSection(typ, ""))
+		return nil
+
+	case strings.HasPrefix(name, "@"):
+		secType, idx, err := unmangleSectionName(name)
+		if err != nil {
+			return err
+		}
+		if secType != typ || idx != cfg.count(typ) {
+			return fmt.Errorf("%w: expected @%s[%d]", ErrInvalidSectionSelector, typ, cfg.count(typ))
+		}
+		cfg.Add(newSection(typ, ""))
+		return nil
+	}
+
+	if sec := cfg.Get(name); sec != nil {
+		if sec.Type != typ {
+			return ErrSectionTypeMismatch{cfg.Name, name, sec.Type, typ}
+		}
+		return nil
+	}
+	cfg.Add(newSection(typ, name))
+	return nil
+}
@@ -0,0 +1,160 @@
+package uci
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const showTestConfig = `
+config interface 'lan'
+	option proto 'static'
+	option ipaddr '192.168.1.1'
+	list dns '1.1.1.1'
+	list dns '8.8.8.8'
+
+config rule
+	option name "it's"
+
+config rule
+	option name 'Allow-Ping'
+`
+
+func TestWriteShow(t *testing.T) {
+	assert := assert.New(t)
+	s := testSnapshot(t, "network", showTestConfig)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteShow(&buf, s, ShowOptions{}))
+	assert.Equal(`network.lan=interface
+network.lan.proto='static'
+network.lan.ipaddr='192.168.1.1'
+network.lan.dns='1.1.1.1' '8.8.8.8'
+network.@rule[0]=rule
+network.@rule[0].name='it'\''s'
+network.@rule[1]=rule
+network.@rule[1].name='Allow-Ping'
+`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, WriteShow(&buf, s, ShowOptions{Anonymous: true}, "network", "missing"))
+	lines := strings.Split(buf.String(), "\n")
+	assert.Equal(`network.cfg0292bd=rule`, lines[4])
+	assert.Equal(`network.cfg0392bd.name='Allow-Ping'`, lines[7])
+}
+
+func TestAnonymousName(t *testing.T) {
+	// excerpts of OpenWrt's default configs, and the section headers
+	// printed by "uci show -X" for them
+	network := testSnapshot(t, "network", `
+config interface 'loopback'
+	option device 'lo'
+	option proto 'static'
+
+config globals 'globals'
+	option ula_prefix 'fd12:3456:789a::/48'
+
+config device
+	option name 'br-lan'
+	option type 'bridge'
+	list ports 'lan1'
+	list ports 'lan2'
+
+config interface 'lan'
+	option device 'br-lan'
+	option proto 'static'
+`)
+	firewall := testSnapshot(t, "firewall", `
+config defaults
+	option syn_flood '1'
+	option input 'REJECT'
+
+config zone
+	option name 'lan'
+	list network 'lan'
+
+config zone
+	option name 'wan'
+	list network 'wan'
+	list network 'wan6'
+
+config forwarding
+	option src 'lan'
+	option dest 'wan'
+
+config rule
+	option name 'Allow-DHCP-Renew'
+	option src 'wan'
+`)
+	for s, want := range map[*TreeSnapshot][]string{
+		network: {
+			"network.loopback=interface",
+			"network.globals=globals",
+			"network.cfg030f15=device",
+			"network.lan=interface",
+		},
+		firewall: {
+			"firewall.cfg01e63d=defaults",
+			"firewall.cfg02dc81=zone",
+			"firewall.cfg03dc81=zone",
+			"firewall.cfg04ad58=forwarding",
+			"firewall.cfg0592bd=rule",
+		},
+	} {
+		var buf bytes.Buffer
+		require.NoError(t, WriteShow(&buf, s, ShowOptions{Anonymous: true}))
+		var headers []string
+		for _, line := range strings.Split(buf.String(), "\n") {
+			if line != "" && strings.Count(line, ".") == 1 {
+				headers = append(headers, line)
+			}
+		}
+		assert.Equal(t, want, headers)
+	}
+
+	assert.Regexp(t, anonymousNameRe, anonymousName(300, "rule"))
+}
+
+func TestNewShowTree(t *testing.T) {
+	assert := assert.New(t)
+	s := testSnapshot(t, "network", showTestConfig)
+
+	for _, opts := range []ShowOptions{{}, {Anonymous: true}} {
+		var buf bytes.Buffer
+		require.NoError(t, WriteShow(&buf, s, opts))
+
+		r, err := NewShowTree(&buf)
+		require.NoError(t, err)
+		dns, ok := r.Get("network", "lan", "dns")
+		assert.True(ok)
+		assert.Equal([]string{"1.1.1.1", "8.8.8.8"}, dns)
+		name, ok := r.GetLast("network", "@rule[0]", "name")
+		assert.True(ok)
+		assert.Equal("it's", name)
+
+		loaded, err := r.Snapshot("network")
+		require.NoError(t, err)
+		assert.True(loaded.configs["network"].equal(s.configs["network"]))
+		diffs, err := r.(DryRunner).DryRun()
+		assert.NoError(err)
+		assert.Empty(diffs)
+		assert.ErrorIs(r.Commit(), ErrArchiveTree)
+	}
+}
+
+func TestNewShowTree_errors(t *testing.T) {
+	for paste, msg := range map[string]string{
+		"network.lan=interface\nnetwork.wan.proto='dhcp'\n": "show: line 2: section network.wan not found",
+		"network.lan\n":                           "show: line 1: " + errShowSyntax.Error(),
+		"network=interface\n":                     "show: line 1: " + errShowSyntax.Error(),
+		"network.lan=interface\nnetwork.lan=zone": "show: line 2: type mismatch for network.lan, got interface, want zone",
+		"network.@rule[1]=rule\n":                 "show: line 1: invalid syntax: section selector must have format '@type[index]': expected @rule[0]",
+		"network.lan.proto='static\n":             "show: line 1: unterminated quote",
+	} {
+		_, err := NewShowTree(strings.NewReader(paste))
+		assert.EqualError(t, err, msg, paste)
+	}
+}
@@ -0,0 +1,131 @@
+package uci
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Reader provides read access to configs. It is implemented by Tree and
+// TreeSnapshot, see Tree for a description of the methods.
+type Reader interface {
+	GetSections(config, secType string) ([]string, error)
+	Get(config, section, option string) ([]string, bool)
+	GetLast(config, section, option string) (string, bool)
+	GetBool(config, section, option string) (bool, bool)
+}
+
+var (
+	_ Reader = Tree(nil)
+	_ Reader = (*TreeSnapshot)(nil)
+)
+
+// A TreeSnapshot is an immutable view of some configs, as created by
+// Tree.Snapshot. It is safe for concurrent use.
+type TreeSnapshot struct {
+	configs map[string]*config
+	schema  *Schema // of the tree, when the snapshot was taken
+}
+
+func (t *tree) Snapshot(configs ...string) (*TreeSnapshot, error) {
+	for _, name := range configs {
+		_, release, err := t.acquire(name, false)
+		if err != nil {
+			return nil, fmt.Errorf("ensureConfigLoaded: %w", err)
+		}
+		release()
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if len(configs) == 0 {
+		for name := range t.configs {
+			configs = append(configs, name)
+		}
+	}
+
+	cfgs := make([]*config, 0, len(configs))
+	for _, name := range configs {
+		cfg, ok := t.configs[name]
+		if !ok {
+			// reverted in the meantime
+			return nil, ErrConfigNotLoaded{Name: name}
+		}
+		cfgs = append(cfgs, cfg)
+	}
+
+	rlockConfigs(cfgs)
+	defer runlockConfigs(cfgs)
+
+	s := &TreeSnapshot{
+		configs: make(map[string]*config, len(cfgs)),
+		schema:  t.schema,
+	}
+	for _, cfg := range cfgs {
+		s.configs[cfg.Name] = cfg.freeze()
+	}
+	return s, nil
+}
+
+// freeze returns a copy of c, which must not be modified. The copy is
+// shared by all snapshots until c is modified (see touch). Its call must
+// be guarded by locking c (at least for reading).
+func (c *config) freeze() *config {
+	if f := c.frozen.Load(); f != nil {
+		return f
+	}
+	c.frozen.CompareAndSwap(nil, c.clone())
+	return c.frozen.Load()
+}
+
+// Configs returns the sorted names of the configs in the snapshot.
+func (s *TreeSnapshot) Configs() []string {
+	names := make([]string, 0, len(s.configs))
+	for name := range s.configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetSections returns the names of all sections of a certain type in a
+// config. It returns ErrConfigNotLoaded, if the config is not part of the
+// snapshot.
+func (s *TreeSnapshot) GetSections(config, secType string) ([]string, error) {
+	cfg, ok := s.configs[config]
+	if !ok {
+		return nil, ErrConfigNotLoaded{Name: config}
+	}
+	return cfg.sectionNames(secType), nil
+}
+
+// Get retrieves (all) values for a fully qualified option, and a boolean
+// indicating whether the config and the section exist in the snapshot.
+// Like Tree.Get, it falls back to deprecated names and defaults defined
+// by the tree's schema (see Tree.SetSchema).
+func (s *TreeSnapshot) Get(config, section, option string) ([]string, bool) {
+	cfg, ok := s.configs[config]
+	if !ok {
+		return nil, false
+	}
+	return s.schema.lookupValues(cfg, section, option)
+}
+
+// GetLast retrieves the last value of a fully qualified option, and a
+// boolean indicating whether the option exists in the snapshot.
+func (s *TreeSnapshot) GetLast(config, section, option string) (string, bool) {
+	vals, ok := s.Get(config, section, option)
+	if !ok || len(vals) == 0 {
+		return "", false
+	}
+	return vals[len(vals)-1], true
+}
+
+// GetBool works like GetLast, but interprets the value as a boolean.
+func (s *TreeSnapshot) GetBool(config, section, option string) (bool, bool) {
+	val, ok := s.GetLast(config, section, option)
+	if !ok {
+		return false, false
+	}
+	return parseBool(val)
+}
@@ -0,0 +1,77 @@
+package uci
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "network", "config interface 'lan'\n\toption proto 'static'\n\toption ipaddr '192.168.1.1'\n")
+	writeTestConfig(t, dir, "system", "config system\n\toption hostname 'OpenWrt'\n")
+
+	r := NewTree(dir)
+	s, err := r.Snapshot("network")
+	require.NoError(t, err)
+	assert.Equal([]string{"network"}, s.Configs())
+
+	require.NoError(t, r.SetType("network", "lan", "proto", TypeOption, "dhcp"))
+	require.NoError(t, r.Del("network", "lan", "ipaddr"))
+
+	// the snapshot is not affected by later changes
+	proto, ok := s.GetLast("network", "lan", "proto")
+	assert.True(ok)
+	assert.Equal("static", proto)
+	values, ok := s.Get("network", "lan", "ipaddr")
+	assert.True(ok)
+	assert.Equal([]string{"192.168.1.1"}, values)
+	sections, err := s.GetSections("network", "interface")
+	assert.NoError(err)
+	assert.Equal([]string{"lan"}, sections)
+
+	// configs not part of the snapshot
+	_, ok = s.Get("system", "@system[0]", "hostname")
+	assert.False(ok)
+	_, err = s.GetSections("system", "system")
+	assert.ErrorIs(err, ErrConfigNotLoaded{Name: "system"})
+
+	// without arguments, all loaded configs are included
+	s, err = r.Snapshot()
+	require.NoError(t, err)
+	assert.Equal([]string{"network"}, s.Configs())
+	proto, _ = s.GetLast("network", "lan", "proto")
+	assert.Equal("dhcp", proto)
+
+	_, err = r.Snapshot("missing")
+	assert.Error(err)
+}
+
+func TestSnapshotSharing(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "test", "config foo 'bar'\n\toption enabled '1'\n")
+
+	r := NewTree(dir).(*tree)
+	a, err := r.Snapshot("test")
+	require.NoError(t, err)
+	b, err := r.Snapshot("test")
+	require.NoError(t, err)
+	assert.Same(a.configs["test"], b.configs["test"])
+	assert.NotSame(r.configs["test"], a.configs["test"])
+
+	// modifications invalidate the shared copy
+	require.NoError(t, r.SetType("test", "bar", "enabled", TypeOption, "0"))
+	c, err := r.Snapshot("test")
+	require.NoError(t, err)
+	assert.NotSame(a.configs["test"], c.configs["test"])
+
+	enabled, ok := a.GetBool("test", "bar", "enabled")
+	assert.True(ok)
+	assert.True(enabled)
+	enabled, ok = c.GetBool("test", "bar", "enabled")
+	assert.True(ok)
+	assert.False(enabled)
+}
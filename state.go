@@ -0,0 +1,369 @@
+package uci
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrInvalidState is returned by DesiredState.Plan for inconsistent
+	// documents.
+	ErrInvalidState = errors.New("invalid desired state")
+
+	// ErrStalePlan is returned by Plan.Apply, if the affected configs
+	// have changed since the plan was created.
+	ErrStalePlan = errors.New("configs have changed since planning")
+)
+
+// DesiredState describes the intended state of some named sections, e.g.
+// the sections managed by a provisioning system. Sections (and options)
+// not mentioned are left alone. The struct tags allow to load the
+// document from JSON:
+//
+//	{"sections":[
+//	  {"config":"network","name":"mgmt","type":"interface",
+//	   "options":{"proto":"static","ipaddr":"10.0.0.2"},
+//	   "lists":{"dns":["10.0.0.1"]}},
+//	  {"config":"network","name":"legacy","absent":true}
+//	]}
+type DesiredState struct {
+	Sections []DesiredSection `json:"sections"`
+}
+
+// DesiredSection describes the intended state of a named section.
+type DesiredSection struct {
+	Config string `json:"config"`
+	Name   string `json:"name"`
+
+	// Absent declares that the section must not exist. All other
+	// fields (except Config and Name) are ignored.
+	Absent bool `json:"absent,omitempty"`
+
+	// Type is the section type. A section of another type is retyped.
+	Type string `json:"type,omitempty"`
+
+	// Options and Lists hold the values of options and lists. An empty
+	// list is removed.
+	Options map[string]string   `json:"options,omitempty"`
+	Lists   map[string][]string `json:"lists,omitempty"`
+
+	// Delete names options to be removed.
+	Delete []string `json:"delete,omitempty"`
+
+	// Exclusive removes all options not given in Options or Lists.
+	Exclusive bool `json:"exclusive,omitempty"`
+}
+
+// A Plan holds the changes needed to reach a desired state, as computed
+// by DesiredState.Plan.
+type Plan struct {
+	// Changes holds the changes for each config, see DiffConfig.
+	// Configs already in the desired state are omitted.
+	Changes map[string][]Change
+
+	tree    Tree
+	configs []string      // changed configs, sorted
+	before  *TreeSnapshot // state of the tree when planning
+	after   *TreeSnapshot // desired state
+}
+
+// Plan compares the desired state with the given tree (including pending
+// changes), and returns the changes needed to reach the desired state.
+// Configs missing in the tree are treated as empty. The tree is not
+// modified.
+func (d *DesiredState) Plan(t Tree) (*Plan, error) {
+	if err := d.validate(); err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, ds := range d.Sections {
+		names = appendUnique(names, ds.Config)
+	}
+	sort.Strings(names)
+
+	before, err := snapshotOrEmpty(t, names)
+	if err != nil {
+		return nil, err
+	}
+	after := &TreeSnapshot{configs: make(map[string]*config, len(names))}
+	for _, name := range names {
+		after.configs[name] = before.configs[name].clone()
+	}
+	for _, ds := range d.Sections {
+		ds.apply(after.configs[ds.Config])
+	}
+
+	p := &Plan{
+		Changes: make(map[string][]Change),
+		tree:    t,
+		before:  before,
+		after:   after,
+	}
+	for _, name := range names {
+		if changes := DiffConfig(before, after, name, DiffOptions{}); len(changes) > 0 {
+			p.Changes[name] = changes
+			p.configs = append(p.configs, name)
+		}
+	}
+	return p, nil
+}
+
+// Reconcile creates a plan (see Plan), and applies it.
+func (d *DesiredState) Reconcile(t Tree) (*Plan, error) {
+	p, err := d.Plan(t)
+	if err != nil {
+		return nil, err
+	}
+	return p, p.Apply()
+}
+
+// validate checks the document for missing fields and contradictions.
+func (d *DesiredState) validate() error {
+	seen := make(map[string]bool, len(d.Sections))
+	for _, ds := range d.Sections {
+		ref := ds.Config + "." + ds.Name
+		switch {
+		case ds.Config == "" || ds.Name == "":
+			return fmt.Errorf("%w: %q: config and section name required", ErrInvalidState, ref)
+		case strings.HasPrefix(ds.Name, "@"):
+			return fmt.Errorf("%w: %q: only named sections are supported", ErrInvalidState, ref)
+		case seen[ref]:
+			return fmt.Errorf("%w: %q: duplicate section", ErrInvalidState, ref)
+		case !ds.Absent && ds.Type == "":
+			return fmt.Errorf("%w: %q: section type required", ErrInvalidState, ref)
+		}
+		seen[ref] = true
+
+		for name := range ds.Lists {
+			if _, ok := ds.Options[name]; ok {
+				return fmt.Errorf("%w: %q: %s given as option and list", ErrInvalidState, ref, name)
+			}
+		}
+		for _, name := range ds.Delete {
+			_, isOpt := ds.Options[name]
+			_, isList := ds.Lists[name]
+			if isOpt || isList {
+				return fmt.Errorf("%w: %q: %s given and deleted", ErrInvalidState, ref, name)
+			}
+		}
+	}
+	return nil
+}
+
+// apply modifies cfg to match ds.
+func (ds *DesiredSection) apply(cfg *config) {
+	if ds.Absent {
+		cfg.Del(ds.Name)
+		return
+	}
+
+	sec := cfg.getNamed(ds.Name)
+	if sec == nil {
+		sec = cfg.Add(newSection(ds.Type, ds.Name))
+	}
+	sec.Type = ds.Type
+
+	// sorted, so that new options are added in a stable order
+	names := make([]string, 0, len(ds.Options)+len(ds.Lists))
+	for name := range ds.Options {
+		names = append(names, name)
+	}
+	for name := range ds.Lists {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		typ, values := TypeList, ds.Lists[name]
+		if v, ok := ds.Options[name]; ok {
+			typ, values = TypeOption, []string{v}
+		}
+		if len(values) == 0 {
+			sec.Del(name)
+			continue
+		}
+		if opt := sec.Get(name); opt != nil {
+			opt.Type = typ
+			opt.SetValues(append([]string(nil), values...)...)
+		} else {
+			sec.Add(newOption(name, typ, append([]string(nil), values...)...))
+		}
+	}
+	for _, name := range ds.Delete {
+		sec.Del(name)
+	}
+
+	if ds.Exclusive {
+		keep := sec.Options[:0]
+		for _, opt := range sec.Options {
+			_, isOpt := ds.Options[opt.Name]
+			_, isList := ds.Lists[opt.Name]
+			if isOpt || isList {
+				keep = append(keep, opt)
+			}
+		}
+		sec.Options = keep
+	}
+}
+
+// snapshotOrEmpty creates a snapshot of the given configs, with empty
+// configs in place of configs missing in t.
+func snapshotOrEmpty(t Tree, names []string) (*TreeSnapshot, error) {
+	s := &TreeSnapshot{configs: make(map[string]*config, len(names))}
+	for _, name := range names {
+		cs, err := t.Snapshot(name)
+		if errors.Is(err, os.ErrNotExist) {
+			s.configs[name] = newConfig(name)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		s.configs[name] = cs.configs[name]
+		s.schema = cs.schema
+	}
+	return s, nil
+}
+
+// Empty reports whether the tree already is in the desired state.
+func (p *Plan) Empty() bool {
+	return len(p.configs) == 0
+}
+
+// WriteBatch writes the plan as script for "uci batch" to w, including
+// commit commands for the changed configs. See EncodeBatch.
+func (p *Plan) WriteBatch(w io.Writer) error {
+	if p.Empty() {
+		return nil
+	}
+	return EncodeBatch(w, p.before, p.after, BatchOptions{Commit: true}, p.configs...)
+}
+
+// Apply executes the plan on the tree it was created for, and commits the
+// changed configs. It does nothing, if the plan is empty. Since the
+// changed configs are committed as a whole, other pending changes to
+// these configs are committed as well.
+//
+// If the sections touched by the plan (or their options known to the
+// plan) have been modified since the plan was created, ErrStalePlan is
+// returned and nothing is changed; a new plan must be created in this
+// case. The check and the modification are performed in a single
+// transaction (see Tree.Update). Since a transaction cannot change the
+// type of a section, retyped sections are recreated at the end of their
+// config.
+func (p *Plan) Apply() error {
+	if p.Empty() {
+		return nil
+	}
+
+	err := p.tree.Update(func(tx Tx) error {
+		for _, name := range p.configs {
+			if err := p.check(tx, name); err != nil {
+				return err
+			}
+		}
+		for _, name := range p.configs {
+			if err := p.apply(tx, name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return p.tree.Commit(p.configs...)
+}
+
+// check compares the sections of a config touched by the plan with their
+// state when planning, and returns ErrStalePlan if they differ.
+func (p *Plan) check(r Reader, config string) error {
+	stale := fmt.Errorf("%w: %s", ErrStalePlan, config)
+	seen := make(map[string]bool)
+	for _, ch := range p.Changes[config] {
+		if seen[ch.Section] {
+			continue
+		}
+		seen[ch.Section] = true
+
+		old := p.before.configs[config].getNamed(ch.Section)
+		if old == nil {
+			if _, exists := r.Get(config, ch.Section, ""); exists {
+				return stale
+			}
+			continue
+		}
+		names, err := r.GetSections(config, old.Type)
+		if err != nil {
+			return stale
+		}
+		if len(appendUnique(names, ch.Section)) > len(names) {
+			return stale // missing or retyped
+		}
+
+		var options []string
+		for _, opt := range old.Options {
+			options = appendUnique(options, opt.Name)
+		}
+		if sec := p.after.configs[config].getNamed(ch.Section); sec != nil {
+			for _, opt := range sec.Options {
+				options = appendUnique(options, opt.Name)
+			}
+		}
+		for _, name := range options {
+			want, _ := p.before.Get(config, ch.Section, name)
+			got, _ := r.Get(config, ch.Section, name)
+			if !equalValues(want, got) {
+				return stale
+			}
+		}
+	}
+	return nil
+}
+
+// apply performs the changes to a config through tx.
+func (p *Plan) apply(tx Tx, config string) error {
+	before, after := p.before.configs[config], p.after.configs[config]
+	for _, ch := range p.Changes[config] {
+		var err error
+		switch ch.Type { //nolint:exhaustive // the plan never moves sections
+		case SectionAdded:
+			err = tx.AddSection(config, ch.Section, ch.SectionType)
+		case SectionRemoved:
+			err = tx.DelSection(config, ch.Section)
+		case SectionRetyped:
+			if err = tx.DelSection(config, ch.Section); err != nil {
+				break
+			}
+			if err = tx.AddSection(config, ch.Section, ch.SectionType); err != nil {
+				break
+			}
+			for _, opt := range after.getNamed(ch.Section).Options {
+				if err = tx.SetType(config, ch.Section, opt.Name, opt.Type, opt.Values...); err != nil {
+					break
+				}
+			}
+		case OptionRemoved:
+			err = tx.Del(config, ch.Section, ch.Option)
+		case OptionSet, ListAdded, ListRemoved:
+			opt := after.getNamed(ch.Section).Get(ch.Option)
+			if sec := before.getNamed(ch.Section); sec != nil {
+				// SetType keeps the type of existing options
+				if prev := sec.Get(ch.Option); prev != nil && prev.Type != opt.Type {
+					err = tx.Del(config, ch.Section, ch.Option)
+				}
+			}
+			if err == nil {
+				err = tx.SetType(config, ch.Section, ch.Option, opt.Type, opt.Values...)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
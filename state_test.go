@@ -0,0 +1,241 @@
+package uci
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const stateTestConfig = `
+config interface 'lan'
+	option proto 'static'
+	option ipaddr '192.168.1.1'
+	list dns '1.1.1.1'
+	option mtu '1500'
+
+config rule
+	option name 'Allow-Ping'
+
+config interface 'legacy'
+	option proto 'none'
+`
+
+const stateTestDocument = `{"sections":[
+	{"config":"network","name":"lan","type":"interface",
+	 "options":{"ipaddr":"10.0.0.1"},"lists":{"dns":["1.1.1.1","9.9.9.9"]},"delete":["mtu"]},
+	{"config":"network","name":"mgmt","type":"interface","options":{"proto":"dhcp"}},
+	{"config":"network","name":"legacy","absent":true},
+	{"config":"system","name":"ntp","type":"timeserver","lists":{"server":["pool.ntp.org"]}}
+]}`
+
+func TestDesiredState(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "network", stateTestConfig)
+	r := NewTree(dir)
+
+	var d DesiredState
+	require.NoError(t, json.Unmarshal([]byte(stateTestDocument), &d))
+
+	p, err := d.Plan(r)
+	require.NoError(t, err)
+	assert.False(p.Empty())
+	assert.Equal(map[string][]Change{
+		"network": {
+			{Type: SectionRemoved, Section: "legacy", SectionType: "interface"},
+			{Type: OptionRemoved, Section: "lan", SectionType: "interface", Option: "mtu"},
+			{Type: OptionSet, Section: "lan", SectionType: "interface", Option: "ipaddr", Values: []string{"10.0.0.1"}},
+			{Type: ListAdded, Section: "lan", SectionType: "interface", Option: "dns", Values: []string{"9.9.9.9"}},
+			{Type: SectionAdded, Section: "mgmt", SectionType: "interface"},
+			{Type: OptionSet, Section: "mgmt", SectionType: "interface", Option: "proto", Values: []string{"dhcp"}},
+		},
+		"system": {
+			{Type: SectionAdded, Section: "ntp", SectionType: "timeserver"},
+			{Type: OptionSet, Section: "ntp", SectionType: "timeserver", Option: "server", Values: []string{"pool.ntp.org"}},
+		},
+	}, p.Changes)
+
+	// planning doesn't modify the tree
+	value, _ := r.GetLast("network", "lan", "ipaddr")
+	assert.Equal("192.168.1.1", value)
+
+	var script bytes.Buffer
+	require.NoError(t, p.WriteBatch(&script))
+	assert.Contains(script.String(), "commit network\n")
+	assert.Contains(script.String(), "commit system\n")
+
+	require.NoError(t, p.Apply())
+	content, err := os.ReadFile(filepath.Join(dir, "network"))
+	require.NoError(t, err)
+	assert.Equal(`
+config interface 'lan'
+	option proto 'static'
+	option ipaddr '10.0.0.1'
+	list dns '1.1.1.1'
+	list dns '9.9.9.9'
+
+config rule
+	option name 'Allow-Ping'
+
+config interface 'mgmt'
+	option proto 'dhcp'
+
+`, string(content))
+	_, err = os.Stat(filepath.Join(dir, "system"))
+	assert.NoError(err)
+
+	// converged
+	p, err = d.Reconcile(r)
+	require.NoError(t, err)
+	assert.True(p.Empty())
+	assert.Empty(p.Changes)
+}
+
+func TestDesiredState_exclusive(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "network", stateTestConfig)
+	r := NewTree(dir)
+
+	d := DesiredState{Sections: []DesiredSection{{
+		Config:    "network",
+		Name:      "lan",
+		Type:      "alias",
+		Options:   map[string]string{"proto": "static"},
+		Exclusive: true,
+	}}}
+	p, err := d.Reconcile(r)
+	require.NoError(t, err)
+	assert.Equal([]Change{
+		{Type: SectionRetyped, Section: "lan", SectionType: "alias", OldType: "interface"},
+		{Type: OptionRemoved, Section: "lan", SectionType: "alias", Option: "ipaddr"},
+		{Type: OptionRemoved, Section: "lan", SectionType: "alias", Option: "dns"},
+		{Type: OptionRemoved, Section: "lan", SectionType: "alias", Option: "mtu"},
+	}, p.Changes["network"])
+
+	require.NoError(t, r.LoadConfig("network", true))
+	sections, _ := r.GetSections("network", "alias")
+	assert.Equal([]string{"lan"}, sections)
+	values, _ := r.Get("network", "lan", "ipaddr")
+	assert.Nil(values)
+}
+
+func TestDesiredState_stale(t *testing.T) {
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "network", stateTestConfig)
+	r := NewTree(dir)
+
+	d := DesiredState{Sections: []DesiredSection{{
+		Config: "network", Name: "lan", Type: "interface",
+		Options: map[string]string{"proto": "dhcp"},
+	}}}
+	p, err := d.Plan(r)
+	require.NoError(t, err)
+
+	require.NoError(t, r.SetType("network", "lan", "mtu", TypeOption, "1400"))
+	assert.ErrorIs(t, p.Apply(), ErrStalePlan)
+	value, _ := r.GetLast("network", "lan", "proto")
+	assert.Equal(t, "static", value)
+}
+
+func TestDesiredState_concurrent(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "network", stateTestConfig)
+	r := NewTree(dir)
+
+	d := DesiredState{Sections: []DesiredSection{{
+		Config: "network", Name: "lan", Type: "interface",
+		Lists: map[string][]string{"ipaddr": {"10.0.0.1", "10.0.1.1"}},
+	}, {
+		Config: "network", Name: "mgmt", Type: "interface",
+	}}}
+	p, err := d.Plan(r)
+	require.NoError(t, err)
+
+	// changes to other sections don't affect the plan
+	require.NoError(t, r.SetType("network", "legacy", "proto", TypeOption, "dhcp"))
+	require.NoError(t, p.Apply())
+	values, _ := r.Get("network", "lan", "ipaddr")
+	assert.Equal([]string{"10.0.0.1", "10.0.1.1"}, values)
+	value, _ := r.GetLast("network", "legacy", "proto")
+	assert.Equal("dhcp", value)
+
+	content, err := os.ReadFile(filepath.Join(dir, "network"))
+	require.NoError(t, err)
+	assert.Contains(string(content), "\tlist ipaddr '10.0.0.1'\n\tlist ipaddr '10.0.1.1'\n")
+
+	// a section added in the meantime makes the plan stale
+	d.Sections[1].Name = "guest"
+	p, err = d.Plan(r)
+	require.NoError(t, err)
+	require.NoError(t, r.AddSection("network", "guest", "interface"))
+	assert.ErrorIs(p.Apply(), ErrStalePlan)
+}
+
+func TestDesiredState_newline(t *testing.T) {
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "system", "config system 'main'\n")
+	r := NewTree(dir)
+
+	d := DesiredState{Sections: []DesiredSection{{
+		Config: "system", Name: "main", Type: "system",
+		Options: map[string]string{"notes": "line 1\nline 2"},
+	}}}
+	p, err := d.Reconcile(r)
+	require.NoError(t, err)
+	assert.Len(t, p.Changes["system"], 1)
+	value, _ := r.GetLast("system", "main", "notes")
+	assert.Equal(t, "line 1\nline 2", value)
+
+	content, err := os.ReadFile(filepath.Join(dir, "system"))
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "option notes 'line 1\nline 2'")
+
+	// such values cannot be exported as batch script
+	assert.Error(t, p.WriteBatch(&bytes.Buffer{}))
+}
+
+func TestDesiredState_readOnly(t *testing.T) {
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "network", stateTestConfig)
+	r := NewTree(dir)
+
+	d := DesiredState{Sections: []DesiredSection{{
+		Config: "network", Name: "lan", Type: "interface",
+		Options: map[string]string{"proto": "dhcp"},
+	}}}
+	_, err := d.Reconcile(ReadOnly(r))
+	var roErr ErrReadOnly
+	assert.ErrorAs(t, err, &roErr)
+	value, _ := r.GetLast("network", "lan", "proto")
+	assert.Equal(t, "static", value)
+}
+
+func TestDesiredState_invalid(t *testing.T) {
+	for _, ds := range []DesiredSection{
+		{Name: "lan", Type: "interface"},
+		{Config: "network", Type: "interface"},
+		{Config: "network", Name: "@rule[0]", Type: "rule"},
+		{Config: "network", Name: "lan"},
+		{Config: "network", Name: "lan", Type: "interface",
+			Options: map[string]string{"dns": "a"}, Lists: map[string][]string{"dns": {"b"}}},
+		{Config: "network", Name: "lan", Type: "interface",
+			Options: map[string]string{"dns": "a"}, Delete: []string{"dns"}},
+	} {
+		d := DesiredState{Sections: []DesiredSection{ds}}
+		_, err := d.Plan(NewTree(t.TempDir()))
+		assert.ErrorIs(t, err, ErrInvalidState, ds)
+	}
+
+	ds := DesiredSection{Config: "network", Name: "lan", Absent: true}
+	d := DesiredState{Sections: []DesiredSection{ds, ds}}
+	_, err := d.Plan(NewTree(t.TempDir()))
+	assert.True(t, strings.Contains(err.Error(), "duplicate"))
+}
@@ -0,0 +1,178 @@
+package uci
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Tx gives access to the configs within Tree.Update. See Tree for a
+// description of the methods. A Tx must not be used after the function
+// passed to Tree.Update has returned.
+type Tx interface {
+	Reader
+
+	SetType(config, section, option string, typ OptionType, values ...string) error
+	Del(config, section, option string) error
+	AddSection(config, section, typ string) error
+	DelSection(config, section string) error
+}
+
+// tx implements Tx. Configs are copied on their first modification, and
+// the copies replace the originals when the transaction succeeds.
+type tx struct {
+	t       *tree
+	configs map[string]*config // copied or loaded configs
+	dirty   map[string]bool    // modified configs
+}
+
+var _ Tx = (*tx)(nil)
+
+func (t *tree) Update(fn func(tx Tx) error) error {
+	return t.update(func(x *tx) error { return fn(x) })
+}
+
+// update implements Update, but passes the transaction's implementation
+// to fn.
+func (t *tree) update(fn func(x *tx) error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	x := &tx{
+		t:       t,
+		configs: make(map[string]*config),
+		dirty:   make(map[string]bool),
+	}
+	if err := fn(x); err != nil {
+		return err
+	}
+
+	for name, cfg := range x.configs {
+		if x.dirty[name] {
+			cfg.touch()
+			t.setConfig(cfg)
+		} else if _, ok := t.configs[name]; !ok {
+			t.setConfig(cfg) // loaded during the transaction
+		}
+	}
+	return nil
+}
+
+// get returns a config for reading, loading it if necessary.
+func (x *tx) get(name string) (*config, error) {
+	if cfg, ok := x.configs[name]; ok {
+		return cfg, nil
+	}
+	if cfg, ok := x.t.configs[name]; ok {
+		return cfg, nil
+	}
+	cfg, err := x.t.readConfig(name)
+	if err != nil {
+		return nil, err
+	}
+	x.configs[name] = cfg
+	return cfg, nil
+}
+
+// modify returns a config for writing. If create is true, a config
+// missing on disk yields a new, empty config.
+func (x *tx) modify(name string, create bool) (*config, error) {
+	if cfg, ok := x.configs[name]; ok {
+		return cfg, nil
+	}
+	if cfg, ok := x.t.configs[name]; ok {
+		cp := cfg.clone()
+		x.configs[name] = cp
+		return cp, nil
+	}
+	cfg, err := x.t.readConfig(name)
+	if create && errors.Is(err, os.ErrNotExist) {
+		cfg, err = newConfig(name), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	x.configs[name] = cfg
+	return cfg, nil
+}
+
+func (x *tx) GetSections(config, secType string) ([]string, error) {
+	cfg, err := x.get(config)
+	if err != nil {
+		return nil, fmt.Errorf("ensureConfigLoaded: %w", err)
+	}
+	return cfg.sectionNames(secType), nil
+}
+
+func (x *tx) Get(config, section, option string) ([]string, bool) {
+	cfg, err := x.get(config)
+	if err != nil {
+		return nil, false
+	}
+	return x.t.schema.lookupValues(cfg, section, option)
+}
+
+func (x *tx) GetLast(config, section, option string) (string, bool) {
+	vals, ok := x.Get(config, section, option)
+	if !ok || len(vals) == 0 {
+		return "", false
+	}
+	return vals[len(vals)-1], true
+}
+
+func (x *tx) GetBool(config, section, option string) (bool, bool) {
+	val, ok := x.GetLast(config, section, option)
+	if !ok {
+		return false, false
+	}
+	return parseBool(val)
+}
+
+func (x *tx) SetType(config, section, option string, typ OptionType, values ...string) error {
+	cfg, err := x.modify(config, false)
+	if err != nil {
+		return fmt.Errorf("ensureConfigLoaded: %w", err)
+	}
+	if err = x.t.schema.checkWrite(cfg, section, option, typ, values); err != nil {
+		return err
+	}
+	if err = cfg.setOption(section, option, typ, values...); err != nil {
+		return err
+	}
+	x.dirty[config] = true
+	return nil
+}
+
+func (x *tx) Del(config, section, option string) error {
+	cfg, err := x.modify(config, false)
+	if err != nil {
+		return fmt.Errorf("ensureConfigLoaded: %w", err)
+	}
+	deleted, err := cfg.delOption(section, option)
+	if deleted {
+		x.dirty[config] = true
+	}
+	return err
+}
+
+func (x *tx) AddSection(config, section, typ string) error {
+	cfg, err := x.modify(config, true)
+	if err != nil {
+		return fmt.Errorf("ensureConfigLoaded: %w", err)
+	}
+	added, err := cfg.addSection(section, typ)
+	if added {
+		x.dirty[config] = true
+	}
+	return err
+}
+
+func (x *tx) DelSection(config, section string) error {
+	cfg, err := x.modify(config, false)
+	if err != nil {
+		return fmt.Errorf("ensureConfigLoaded: %w", err)
+	}
+	cfg.Del(section)
+	x.dirty[config] = true
+	return nil
+}
@@ -0,0 +1,84 @@
+package uci
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdate(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "firewall", "config zone 'lan'\n\tlist network 'lan'\n")
+
+	r := NewTree(dir).(*tree)
+	require.NoError(t, r.LoadConfig("firewall", false))
+	orig := r.configs["firewall"]
+
+	err := r.Update(func(tx Tx) error {
+		if err := tx.AddSection("network", "guest", "interface"); err != nil {
+			return err
+		}
+		if err := tx.SetType("network", "guest", "proto", TypeOption, "static"); err != nil {
+			return err
+		}
+		networks, _ := tx.Get("firewall", "lan", "network")
+		if err := tx.SetType("firewall", "lan", "network", TypeList, append(networks, "guest")...); err != nil {
+			return err
+		}
+
+		// changes are visible within the transaction only
+		proto, ok := tx.GetLast("network", "guest", "proto")
+		assert.True(ok)
+		assert.Equal("static", proto)
+		assert.NotContains(r.configs, "network")
+		assert.Len(orig.Sections[0].Options[0].Values, 1)
+		return nil
+	})
+	require.NoError(t, err)
+
+	values, ok := r.Get("firewall", "lan", "network")
+	assert.True(ok)
+	assert.Equal([]string{"lan", "guest"}, values)
+	proto, ok := r.GetLast("network", "guest", "proto")
+	assert.True(ok)
+	assert.Equal("static", proto)
+	assert.True(r.configs["firewall"].tainted)
+	assert.True(r.configs["network"].tainted)
+}
+
+func TestUpdate_rollback(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "network", "config interface 'lan'\n\toption proto 'dhcp'\n")
+
+	r := NewTree(dir).(*tree)
+	errAbort := errors.New("abort")
+	err := r.Update(func(tx Tx) error {
+		assert.NoError(tx.SetType("network", "lan", "proto", TypeOption, "static"))
+		assert.NoError(tx.DelSection("network", "lan"))
+		assert.NoError(tx.AddSection("system", "main", "system"))
+		return errAbort
+	})
+	assert.ErrorIs(err, errAbort)
+
+	proto, ok := r.GetLast("network", "lan", "proto")
+	assert.True(ok)
+	assert.Equal("dhcp", proto)
+	assert.False(r.configs["network"].tainted)
+	assert.NotContains(r.configs, "system")
+
+	// failing operations do not mark a config as modified
+	err = r.Update(func(tx Tx) error {
+		assert.ErrorIs(tx.SetType("network", "wan", "proto", TypeOption, "dhcp"),
+			ErrSectionNotFound{Section: "wan"})
+		assert.Error(tx.AddSection("network", "lan", "zone"))
+		_, err := tx.GetSections("missing", "foo")
+		assert.Error(err)
+		return nil
+	})
+	assert.NoError(err)
+	assert.False(r.configs["network"].tainted)
+}
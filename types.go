@@ -7,6 +7,8 @@ import (
 	"io"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 // NOTE: config, section and option types basically are AST nodes for the
@@ -14,14 +16,19 @@ import (
 // purposes: We'er generating JSON dumps of the tree when running tests
 // with DUMP="json". After a manual comparison with the corresponding UCI
 // file in testdata/, we can use the dumps to read them back as test case
-// expectations.
+// expectations. The public JSON representation is implemented in json.go
+// (see WriteJSON).
 
 // config represents a file in UCI. It consists of sections.
 type config struct {
 	Name     string     `json:"name"`
 	Sections []*section `json:"sections,omitempty"`
 
-	tainted bool // changed by tree methods when things were modified
+	tainted bool   // changed by tree methods when things were modified
+	gen     uint64 // incremented on each modification, see touch()
+
+	mu     sync.RWMutex           // see lock.go
+	frozen atomic.Pointer[config] // cached copy for snapshots, see freeze()
 }
 
 // newConfig returns a new config object.
@@ -57,6 +64,79 @@ func (c *config) WriteTo(w io.Writer) (n int64, err error) {
 	return buf.WriteTo(w)
 }
 
+// clone returns a deep copy of c.
+func (c *config) clone() *config {
+	cp := &config{
+		Name:     c.Name,
+		Sections: make([]*section, len(c.Sections)),
+		tainted:  c.tainted,
+	}
+	for i, sec := range c.Sections {
+		cp.Sections[i] = sec.clone()
+	}
+	return cp
+}
+
+// equal reports whether c and other serialize to the same content.
+func (c *config) equal(other *config) bool {
+	var a, b bytes.Buffer
+	_, _ = c.WriteTo(&a)
+	_, _ = other.WriteTo(&b)
+	return bytes.Equal(a.Bytes(), b.Bytes())
+}
+
+// sectionNames returns the (possibly synthetic) names of all sections of
+// the given type.
+func (c *config) sectionNames(typ string) []string {
+	names := []string{}
+	for _, s := range c.Sections {
+		if s.Type == typ {
+			names = append(names, c.sectionName(s))
+		}
+	}
+	return names
+}
+
+// setOption replaces an option of a section with the given values, or
+// adds it if missing.
+func (c *config) setOption(section, option string, typ OptionType, values ...string) error {
+	sec := c.Get(section)
+	if sec == nil {
+		return ErrSectionNotFound{Section: section}
+	}
+
+	if opt := sec.Get(option); opt != nil {
+		opt.SetValues(values...)
+	} else {
+		sec.Add(newOption(option, typ, values...))
+	}
+	return nil
+}
+
+// delOption removes an option from a section, and reports whether it
+// existed.
+func (c *config) delOption(section, option string) (bool, error) {
+	sec := c.Get(section)
+	if sec == nil {
+		return false, ErrSectionNotFound{Section: section}
+	}
+	return sec.Del(option), nil
+}
+
+// addSection adds a new section, unless a section with the same name and
+// type already exists. It reports whether the section was added.
+func (c *config) addSection(section, typ string) (bool, error) {
+	sec := c.Get(section)
+	if sec == nil {
+		c.Add(newSection(typ, section))
+		return true, nil
+	}
+	if sec.Type != typ {
+		return false, ErrSectionTypeMismatch{c.Name, section, sec.Type, typ}
+	}
+	return false, nil
+}
+
 // Get fetches a section by name.
 //
 // Support for unnamed section notation (@foo[idx]) is present.
@@ -192,6 +272,28 @@ func (c *config) Del(name string) {
 	}
 }
 
+// remove deletes the given section (compared by identity). It returns
+// the former position of s, or -1 if s was not found.
+func (c *config) remove(s *section) int {
+	for i, sec := range c.Sections {
+		if sec == s {
+			c.Sections = append(c.Sections[:i], c.Sections[i+1:]...)
+			return i
+		}
+	}
+	return -1
+}
+
+// insert adds s at the given position (or at the end, if pos is out of
+// bounds).
+func (c *config) insert(pos int, s *section) {
+	if pos < 0 || pos >= len(c.Sections) {
+		c.Sections = append(c.Sections, s)
+		return
+	}
+	c.Sections = append(c.Sections[:pos], append([]*section{s}, c.Sections[pos:]...)...)
+}
+
 func (c *config) sectionName(s *section) string {
 	if s.Name != "" {
 		return s.Name
@@ -238,6 +340,19 @@ func newSection(typ, name string) *section {
 	}
 }
 
+// clone returns a deep copy of s.
+func (s *section) clone() *section {
+	cp := &section{
+		Name:    s.Name,
+		Type:    s.Type,
+		Options: make([]*option, len(s.Options)),
+	}
+	for i, opt := range s.Options {
+		cp.Options[i] = opt.clone()
+	}
+	return cp
+}
+
 func (s *section) Add(o *option) {
 	s.Options = append(s.Options, o)
 }
@@ -298,6 +413,11 @@ func newOption(name string, optionType OptionType, values ...string) *option {
 	}
 }
 
+// clone returns a deep copy of o.
+func (o *option) clone() *option {
+	return newOption(o.Name, o.Type, append([]string(nil), o.Values...)...)
+}
+
 func (o *option) SetValues(vs ...string) {
 	o.Values = vs
 }
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"sync"
@@ -24,18 +25,51 @@ type Tree interface {
 	// load missing files automatically.
 	LoadConfig(name string, forceReload bool) error
 
-	// Commit writes all changes back to the system.
+	// Commit writes all changes back to the system. If config names are
+	// given, only these configs are written, while changes to other
+	// configs stay pending. Each given config must be loaded, otherwise
+	// an ErrConfigNotLoaded is returned and nothing is written.
+	//
+	// Before writing, all pre-commit hooks (see HookRegistrar) are called
+	// with the names of the modified configs, and then the validators
+	// registered for these configs are run. If any hook or validator fails, nothing is written
+	// (validation failures are reported as ValidationError). After
+	// writing, the post-commit hooks are called with the names of the
+	// configs actually written (errors from these hooks are returned,
+	// but do not undo the commit). Hooks are run without holding the
+	// tree's lock.
 	//
 	// Note: this is not transaction safe. If, for whatever reason, the
 	// writing of any file fails, the succeeding files are left untouched
 	// while the preceding files are not reverted.
-	Commit() error
+	Commit(configs ...string) error
+
+	// SetSchema defines the section types and options of the configs
+	// described by s. Get, GetLast, GetBool and GetPath (as well as
+	// snapshots) fall back to deprecated names and defaults of missing
+	// options. SetType (as well as the path and transaction methods,
+	// Batch and Import) reject unknown, deprecated and mistyped options
+	// with a ValidationError, and Commit validates the configs against
+	// the schema, like validators do. Pass nil to remove the schema
+	// again.
+	SetSchema(s *Schema)
 
 	// Revert undoes changes to the config files given as arguments. If
 	// no argument is given, all changes are reverted. This clears the
 	// internal memory and does not access the file system.
 	Revert(configs ...string)
 
+	// RevertSection undoes pending changes to a single section, restoring
+	// its last committed (on-disk) state, while keeping other pending
+	// changes. A section missing on disk is removed. Unnamed sections are
+	// matched by their synthetic name (e.g. "@rule[2]").
+	RevertSection(config, section string) error
+
+	// RevertOption undoes pending changes to a single option, restoring
+	// its last committed (on-disk) state, while keeping other pending
+	// changes. An option missing on disk is removed.
+	RevertOption(config, section, option string) error
+
 	// GetSections returns the names of all sections of a certain type
 	// in a config, and an error indicating whether the operation was
 	// successful.
@@ -56,6 +90,12 @@ type Tree interface {
 	// interpreted as either true or false, it will return nil and false.
 	GetBool(config, section, option string) (bool, bool)
 
+	// Snapshot returns an immutable view of the given configs (or of all
+	// loaded configs, if none are given), loading them if necessary.
+	// Reading from the snapshot needs no locking, and is not affected by
+	// later changes to the tree.
+	Snapshot(configs ...string) (*TreeSnapshot, error)
+
 	// SetType replaces the fully qualified option with the given values.
 	// It returns whether the config file and section exists. For new
 	// files and sections, you first need to initialize them with
@@ -72,13 +112,48 @@ type Tree interface {
 
 	// DelSection remove a config section and its options.
 	DelSection(config, section string) error
+
+	// Update calls fn with a transaction, which provides the same read
+	// and write methods as Tree. The changes made through the transaction
+	// are applied to the tree at once, if fn returns nil, and discarded
+	// otherwise. The tree is locked while fn runs, so fn must not access
+	// the tree directly (use the transaction instead).
+	Update(fn func(tx Tx) error) error
+}
+
+// DefaultFileMode is used for new config files, unless overridden with
+// FileModeSetter.SetFileMode.
+const DefaultFileMode os.FileMode = 0o644
+
+// A FileModeSetter controls the permissions of new config files. Trees
+// created by NewTree implement it, and so do their wrappers (see ReadOnly
+// and Fork), if the wrapped tree does.
+type FileModeSetter interface {
+	// SetFileMode defines the permissions for a config file, which does
+	// not exist yet, e.g. 0o600 for files containing secrets. Existing
+	// files always keep their mode and ownership, and symlinks are
+	// followed to update the actual file.
+	SetFileMode(config string, mode os.FileMode)
 }
 
 type tree struct {
 	dir     string
 	configs map[string]*config
 
-	sync.Mutex
+	preCommit  []CommitHook
+	postCommit []CommitHook
+	fileModes  map[string]os.FileMode // for new files, see SetFileMode
+	validators map[string][]Validator // by config name, "" for all
+	schema     *Schema
+	history    *History
+
+	archive     map[string][]byte      // file contents, see NewArchiveTree
+	archiveInfo map[string]os.FileInfo // file modes and times, by name
+
+	// mu guards the configs map (and the settings above). The content of
+	// each config is guarded by the config's own lock. See lock.go for
+	// the locking rules.
+	mu sync.RWMutex
 }
 
 var _ Tree = (*tree)(nil)
@@ -92,93 +167,177 @@ func NewTree(root string) Tree {
 }
 
 func (t *tree) LoadConfig(name string, forceReload bool) error {
-	t.Lock()
-	defer t.Unlock()
+	t.mu.RLock()
+	_, exists := t.configs[name]
+	t.mu.RUnlock()
+	if exists && !forceReload {
+		return ErrConfigAlreadyLoaded{name}
+	}
 
-	var exists bool
-	if t.configs != nil {
-		_, exists = t.configs[name]
+	cfg, err := t.readConfig(name)
+	if err != nil {
+		return err
 	}
-	if exists && !forceReload {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, exists = t.configs[name]; exists && !forceReload {
 		return ErrConfigAlreadyLoaded{name}
 	}
-	return t.loadConfig(name)
+	t.setConfig(cfg)
+	return nil
 }
 
 // loadConfig actually reads a config file. Its call must be guarded by
-// locking the tree's mutex.
+// exclusively locking the tree's mutex.
 func (t *tree) loadConfig(name string) error {
-	body, err := os.ReadFile(filepath.Join(t.dir, name))
+	cfg, err := t.readConfig(name)
+	if err != nil {
+		return err
+	}
+	t.setConfig(cfg)
+	return nil
+}
+
+// setConfig adds or replaces a config in the tree. Its call must be
+// guarded by exclusively locking the tree's mutex.
+func (t *tree) setConfig(cfg *config) {
+	if t.configs == nil {
+		t.configs = make(map[string]*config)
+	}
+	t.configs[cfg.Name] = cfg
+}
+
+// readFile reads a config file from the tree's directory, or from the
+// archive the tree was created from.
+func (t *tree) readFile(name string) ([]byte, error) {
+	if t.archive == nil {
+		return os.ReadFile(filepath.Join(t.dir, name))
+	}
+	body, ok := t.archive[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: ArchivePrefix + name, Err: fs.ErrNotExist}
+	}
+	return body, nil
+}
+
+// readConfig reads and parses a config file, without storing the result
+// in the tree.
+func (t *tree) readConfig(name string) (*config, error) {
+	body, err := t.readFile(name)
 	if err != nil {
-		return fmt.Errorf("reading config file failed: %w", err)
+		return nil, fmt.Errorf("reading config file failed: %w", err)
 	}
 	cfg, err := parse(name, string(body))
 	if err != nil {
-		return fmt.Errorf("parse: %w", err)
+		return nil, fmt.Errorf("parse: %w", err)
 	}
+	return cfg, nil
+}
 
-	if t.configs == nil {
-		t.configs = make(map[string]*config)
+func (t *tree) Commit(configs ...string) error {
+	names, pre, post, err := t.taintedConfigs(configs...)
+	if err != nil {
+		return err
 	}
-	t.configs[name] = cfg
-	return nil
+	_, err = t.commitWithHooks(names, "", pre, post)
+	return err
 }
 
-func (t *tree) Commit() error {
-	t.Lock()
-	defer t.Unlock()
+// commit writes the named configs, if they still have pending changes,
+// and records them in the history (if enabled). It returns the names of
+// the configs written so far, even on errors. Failing to update the
+// history does not abort the commit, but is reported.
+//
+// The configs are only locked for reading while being validated and
+// written, so that readers are not blocked by slow disk I/O. Changes made
+// concurrently (after the configs have been written) are kept pending.
+func (t *tree) commit(names []string, message string) ([]string, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	configs := make([]*config, 0, len(names))
+	for _, name := range names {
+		if cfg, ok := t.configs[name]; ok {
+			configs = append(configs, cfg)
+		}
+	}
+	gens := rlockConfigs(configs)
+	written, err := t.save(configs, message)
+	runlockConfigs(configs)
 
-	for _, config := range t.configs {
-		if !config.tainted {
+	committed := make([]string, 0, len(written))
+	for i, cfg := range configs {
+		if !written[i] {
 			continue
 		}
-		err := t.saveConfig(config)
-		if err != nil {
-			return err
+		cfg.mu.Lock()
+		if cfg.gen == gens[i] {
+			cfg.tainted = false
 		}
+		cfg.mu.Unlock()
+		committed = append(committed, cfg.Name)
 	}
-	return nil
+	return committed, err
+}
+
+// save validates and writes the given configs. It reports for each config,
+// whether it has been written. Its call must be guarded by locking the
+// tree's mutex and the configs (at least for reading).
+func (t *tree) save(configs []*config, message string) ([]bool, error) {
+	written := make([]bool, len(configs))
+	if err := t.validate(configs); err != nil {
+		return written, err
+	}
+
+	var errs []error
+	for i, cfg := range configs {
+		if !cfg.tainted {
+			continue
+		}
+		baseline := t.historyBaseline(cfg.Name)
+		if err := t.saveConfig(cfg); err != nil {
+			return written, errors.Join(append(errs, err)...)
+		}
+		written[i] = true
+		if err := t.recordHistory(cfg, baseline, message); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return written, errors.Join(errs...)
 }
 
 func (t *tree) Revert(configs ...string) {
-	t.Lock()
+	t.mu.Lock()
 	if len(configs) == 0 {
 		t.configs = nil
 	}
 	for _, config := range configs {
 		delete(t.configs, config)
 	}
-	t.Unlock()
+	t.mu.Unlock()
 }
 
 func (t *tree) GetSections(config string, secType string) ([]string, error) {
-	cfg, err := t.ensureConfigLoaded(config)
+	cfg, release, err := t.acquire(config, false)
 	if err != nil {
 		return nil, fmt.Errorf("ensureConfigLoaded: %w", err)
 	}
+	defer release()
 
-	names := []string{}
-	for _, s := range cfg.Sections {
-		if s.Type == secType {
-			names = append(names, cfg.sectionName(s))
-		}
-	}
-
-	return names, nil
+	return cfg.sectionNames(secType), nil
 }
 
 func (t *tree) Get(config, section, option string) ([]string, bool) {
-	t.Lock()
-	defer t.Unlock()
-
-	if vals, ok := t.lookupValues(config, section, option); ok {
-		return vals, true
-	}
-
-	if err := t.loadConfig(config); err != nil {
+	schema := t.getSchema()
+	cfg, release, err := t.acquire(config, false)
+	if err != nil {
 		return nil, false
 	}
-	return t.lookupValues(config, section, option)
+	defer release()
+
+	return schema.lookupValues(cfg, section, option)
 }
 
 func (t *tree) GetLast(config, section, option string) (string, bool) {
@@ -195,6 +354,11 @@ func (t *tree) GetBool(config, section, option string) (bool, bool) {
 	if !ok {
 		return false, false
 	}
+	return parseBool(val)
+}
+
+// parseBool interprets a value the same way UCI does.
+func parseBool(val string) (bool, bool) {
 	switch val {
 	case "1", "on", "true", "yes", "enabled":
 		return true, true
@@ -205,129 +369,108 @@ func (t *tree) GetBool(config, section, option string) (bool, bool) {
 	}
 }
 
-func (t *tree) ensureConfigLoaded(config string) (*config, error) {
-	cfg, ok := t.configs[config]
-	if !ok {
-		if err := t.loadConfig(config); err != nil {
-			return nil, fmt.Errorf("loadConfig: %w", err)
-		}
-		cfg = t.configs[config]
-	}
-	return cfg, nil
-}
-
-func (t *tree) lookupOption(config, section, option string) (*option, bool) {
-	cfg, ok := t.configs[config]
-	if !ok {
-		return nil, false
-	}
-	sec := cfg.Get(section)
-	if sec == nil {
-		return nil, false
-	}
-	return sec.Get(option), true
-}
-
-func (t *tree) lookupValues(config, section, option string) ([]string, bool) {
-	opt, ok := t.lookupOption(config, section, option)
-	if !ok {
-		return nil, false
-	}
-	if opt == nil {
-		return nil, true
-	}
-	return opt.Values, true
-}
-
 func (t *tree) SetType(config, section, option string, typ OptionType, values ...string) error {
-	t.Lock()
-	defer t.Unlock()
-
-	cfg, err := t.ensureConfigLoaded(config)
+	schema := t.getSchema()
+	cfg, release, err := t.acquire(config, true)
 	if err != nil {
 		return fmt.Errorf("ensureConfigLoaded: %w", err)
 	}
-	sec := cfg.Get(section)
-	if sec == nil {
-		return ErrSectionNotFound{Section: section}
-	}
+	defer release()
 
-	if opt := sec.Get(option); opt != nil {
-		opt.SetValues(values...)
-	} else {
-		sec.Add(newOption(option, typ, values...))
+	if err = schema.checkWrite(cfg, section, option, typ, values); err != nil {
+		return err
+	}
+	if err = cfg.setOption(section, option, typ, values...); err != nil {
+		return err
 	}
-	cfg.tainted = true
+	cfg.touch()
 	return nil
 }
 
 func (t *tree) Del(config, section, option string) error {
-	t.Lock()
-	defer t.Unlock()
-
-	cfg, err := t.ensureConfigLoaded(config)
+	cfg, release, err := t.acquire(config, true)
 	if err != nil {
 		// we want to delete option but this failed
 		return fmt.Errorf("ensureConfigLoaded: %w", err)
 	}
+	defer release()
 
-	sec := cfg.Get(section)
-	if sec == nil {
-		// same logic applies here
-		return ErrSectionNotFound{Section: section}
+	deleted, err := cfg.delOption(section, option)
+	if deleted {
+		cfg.touch()
 	}
-
-	if sec.Del(option) {
-		cfg.tainted = true
-	}
-	return nil
+	return err
 }
 
 func (t *tree) AddSection(config, section, typ string) error {
-	t.Lock()
-	defer t.Unlock()
-
-	cfg, err := t.ensureConfigLoaded(config)
-	if err != nil {
-		if errors.Is(err, ParseError{}) {
-			return fmt.Errorf("ensureConfigLoaded: %w", err)
-		}
-		if errors.Is(err, os.ErrNotExist) {
-			// we want to add a section, but it failed to load. If this is a file not found error, we can
-			// just create a new config and add the section to it.
-			// if it is a parse error we want to return that error
-			cfg = newConfig(config)
-			cfg.tainted = true
-			t.configs[config] = cfg
-		}
-	}
-	sec := cfg.Get(section)
-	if sec == nil {
-		cfg.Add(newSection(typ, section))
-		cfg.tainted = true
-		return nil
+	cfg, release, err := t.acquire(config, true)
+	if errors.Is(err, os.ErrNotExist) {
+		// we want to add a section, but it failed to load. If this is a file not found error, we can
+		// just create a new config and add the section to it.
+		// if it is a parse error we want to return that error
+		cfg, release = t.create(config)
+	} else if err != nil {
+		return fmt.Errorf("ensureConfigLoaded: %w", err)
 	}
-	if sec.Type != typ {
-		return ErrSectionTypeMismatch{config, section, sec.Type, typ}
+	defer release()
+
+	added, err := cfg.addSection(section, typ)
+	if added {
+		cfg.touch()
 	}
-	return nil
+	return err
 }
 
 func (t *tree) DelSection(config, section string) error {
-	t.Lock()
-	defer t.Unlock()
-
-	cfg, err := t.ensureConfigLoaded(config)
+	cfg, release, err := t.acquire(config, true)
 	if err != nil {
 		return fmt.Errorf("ensureConfigLoaded: %w", err)
 	}
+	defer release()
+
 	cfg.Del(section)
-	cfg.tainted = true
+	cfg.touch()
 	return nil
 }
 
+var _ FileModeSetter = (*tree)(nil)
+
+func (t *tree) SetFileMode(config string, mode os.FileMode) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.fileModes == nil {
+		t.fileModes = make(map[string]os.FileMode)
+	}
+	t.fileModes[config] = mode.Perm()
+}
+
+// saveConfig writes a config to its file. Clearing the tainted flag is
+// up to the caller.
 func (t *tree) saveConfig(c *config) error {
-	// We need to create a tempfile in the tree's base directory, since
+	return t.writeFile(c.Name, c)
+}
+
+// writeFile atomically replaces the named file in the tree's directory
+// with the given content. If the file is a symlink, its target is
+// replaced instead. The mode and ownership of an existing file are
+// preserved (the latter as far as permitted, see setOwner), new files
+// are created with the mode set by SetFileMode (DefaultFileMode if
+// unset).
+func (t *tree) writeFile(name string, content io.WriterTo) error {
+	target := resolveSymlink(filepath.Join(t.dir, name))
+
+	mode, ok := t.fileModes[name]
+	if !ok {
+		mode = DefaultFileMode
+	}
+	uid, gid, hasOwner := -1, -1, false
+	if fi, err := os.Stat(target); err == nil {
+		mode = fi.Mode().Perm()
+		uid, gid, hasOwner = fileOwner(fi)
+	}
+
+	// We need to create a tempfile in the target's directory, since
 	// os.Rename fails when that directory and ioutil.Tempdir are on
 	// different file systems (os.Rename being not much more than a shim
 	// for syscall.Renameat).
@@ -339,23 +482,30 @@ func (t *tree) saveConfig(c *config) error {
 	// We rely a bit on the fact that UCI ignores dotfiles in /etc/config,
 	// so this should not interfere with normal operations when we leave
 	// incomplete files behind (for whatever reason).
-	f, err := newTmpFile(t.dir, ".*."+c.Name)
+	f, err := newTmpFile(filepath.Dir(target), ".*."+filepath.Base(target))
 	if err != nil {
 		return err
 	}
 
-	_, err = c.WriteTo(f)
+	_, err = content.WriteTo(f)
 	if err != nil {
 		f.Close()
 		_ = f.Remove()
 		return err
 	}
 
-	if err = f.Chmod(0o644); err != nil {
+	if err = f.Chmod(mode); err != nil {
 		f.Close()
 		_ = f.Remove()
 		return fmt.Errorf("save: failed to set permissions: %w", err)
 	}
+	if hasOwner {
+		if err = setOwner(f, uid, gid); err != nil {
+			f.Close()
+			_ = f.Remove()
+			return fmt.Errorf("save: failed to set ownership: %w", err)
+		}
+	}
 	if err = f.Sync(); err != nil {
 		f.Close()
 		_ = f.Remove()
@@ -363,24 +513,73 @@ func (t *tree) saveConfig(c *config) error {
 	}
 	f.Close()
 
-	if err = f.Rename(filepath.Join(t.dir, c.Name)); err != nil {
+	if err = f.Rename(target); err != nil {
 		return fmt.Errorf("save: failed to replace existing config: %w", err)
 	}
-
-	c.tainted = false
 	return nil
 }
 
+// resolveSymlink follows symlinks in path. If path (or its final target)
+// does not exist yet, the (last) symlink target is returned, so that it
+// can be created.
+func resolveSymlink(path string) string {
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		return real
+	}
+	for i := 0; i < 255; i++ { // guard against loops
+		dest, err := os.Readlink(path)
+		if err != nil {
+			break
+		}
+		if !filepath.IsAbs(dest) {
+			dest = filepath.Join(filepath.Dir(path), dest)
+		}
+		path = dest
+	}
+	return path
+}
+
+// optional returns t as the optional interface I (e.g. HistoryKeeper),
+// or an ErrNotSupported for the method op.
+func optional[I any](t Tree, op string) (I, error) {
+	i, ok := t.(I)
+	if !ok {
+		return i, ErrNotSupported{Op: op}
+	}
+	return i, nil
+}
+
 // tmpFile is used by *tree.saveConfig to create/update a config file.
 type tmpFile interface {
 	io.Writer
 	Chmod(os.FileMode) error
+	Chown(uid, gid int) error
 	Close() error
 	Remove() error
 	Rename(string) error
+	Stat() (os.FileInfo, error)
 	Sync() error
 }
 
+// setOwner changes the ownership of f, unless it already matches. Since
+// unprivileged processes cannot give files away, a permission error is
+// ignored for them: the file then keeps the process' ownership.
+func setOwner(f tmpFile, uid, gid int) error {
+	if fi, err := f.Stat(); err == nil {
+		if u, g, ok := fileOwner(fi); ok && u == uid && g == gid {
+			return nil
+		}
+	}
+	err := f.Chown(uid, gid)
+	if errors.Is(err, os.ErrPermission) && geteuid() != 0 {
+		return nil
+	}
+	return err
+}
+
+// geteuid purely exists to be replaced in tests.
+var geteuid = os.Geteuid
+
 // newTmpFile purely exists to be replaced in tests.
 var newTmpFile = func(dir, pattern string) (tmpFile, error) {
 	f, err := os.CreateTemp(dir, pattern)
@@ -393,7 +592,9 @@ var newTmpFile = func(dir, pattern string) (tmpFile, error) {
 type tmpFileImpl struct{ *os.File }
 
 func (tmp *tmpFileImpl) Chmod(mode os.FileMode) error { return tmp.File.Chmod(mode) }
+func (tmp *tmpFileImpl) Chown(uid, gid int) error     { return tmp.File.Chown(uid, gid) }
 func (tmp *tmpFileImpl) Close() error                 { return tmp.File.Close() }
 func (tmp *tmpFileImpl) Remove() error                { return os.Remove(tmp.File.Name()) }
 func (tmp *tmpFileImpl) Rename(newpath string) error  { return os.Rename(tmp.File.Name(), newpath) }
+func (tmp *tmpFileImpl) Stat() (os.FileInfo, error)   { return tmp.File.Stat() }
 func (tmp *tmpFileImpl) Sync() error                  { return tmp.File.Sync() }
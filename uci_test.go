@@ -429,6 +429,44 @@ func TestCommit(t *testing.T) {
 	assert.NoError(r.Commit())
 }
 
+func TestFileModeSetter(t *testing.T) {
+	assert := assert.New(t)
+	r := NewTree(t.TempDir())
+
+	assert.Implements((*FileModeSetter)(nil), r)
+	assert.Implements((*FileModeSetter)(nil), ReadOnly(r))
+	assert.Implements((*FileModeSetter)(nil), r.(Cloner).Clone())
+
+	// forks of trees without file mode support
+	f := &Fork{Tree: struct{ Tree }{r}}
+	f.SetFileMode("wireless", 0o600) // no-op
+}
+
+func TestCommit_subset(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	r := NewTree(dir)
+
+	assert.NoError(r.AddSection("network", "lan", "interface"))
+	assert.NoError(r.AddSection("firewall", "wan", "zone"))
+
+	err := r.Commit("network", "dhcp")
+	assert.ErrorAs(err, &ErrConfigNotLoaded{})
+	assert.EqualError(err, "dhcp not loaded")
+	assert.NoFileExists(filepath.Join(dir, "network"))
+
+	assert.NoError(r.Commit("network"))
+	assert.FileExists(filepath.Join(dir, "network"))
+	assert.NoFileExists(filepath.Join(dir, "firewall"))
+	assert.True(r.(*tree).configs["firewall"].tainted)
+
+	// untainted configs are skipped
+	assert.NoError(r.Commit("network"))
+
+	assert.NoError(r.Commit())
+	assert.FileExists(filepath.Join(dir, "firewall"))
+}
+
 type mockTempFile struct {
 	mock.Mock
 	bytes.Buffer
@@ -448,6 +486,11 @@ func (m *mockTempFile) Chmod(mode os.FileMode) error {
 	return args.Error(0)
 }
 
+func (m *mockTempFile) Chown(uid, gid int) error {
+	args := m.Called(uid, gid)
+	return args.Error(0)
+}
+
 func (m *mockTempFile) Close() error {
 	args := m.Called()
 	return args.Error(0)
@@ -463,6 +506,12 @@ func (m *mockTempFile) Rename(newpath string) error {
 	return args.Error(0)
 }
 
+func (m *mockTempFile) Stat() (os.FileInfo, error) {
+	args := m.Called()
+	fi, _ := args.Get(0).(os.FileInfo)
+	return fi, args.Error(1)
+}
+
 func (m *mockTempFile) Sync() error {
 	args := m.Called()
 	return args.Error(0)
@@ -0,0 +1,132 @@
+package uci
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// InitScriptDir is the location of init scripts on OpenWrt devices.
+const InitScriptDir = "/etc/init.d"
+
+// UCITrack describes which init scripts need to be reloaded when a
+// config changes, and which other configs are affected by a change, as
+// defined in OpenWrt's /etc/config/ucitrack:
+//
+//	config network
+//		option init network
+//		list affects dhcp
+//
+// Each section is named after the config it describes. Multiple sections
+// for the same config are merged.
+type UCITrack struct {
+	inits   map[string][]string // config name => init scripts
+	affects map[string][]string // config name => affected config names
+}
+
+// ParseUCITrack reads a ucitrack config from r.
+func ParseUCITrack(r io.Reader) (*UCITrack, error) {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading ucitrack failed: %w", err)
+	}
+	cfg, err := parse("ucitrack", string(body))
+	if err != nil {
+		return nil, fmt.Errorf("parse: %w", err)
+	}
+	return newUCITrack(cfg), nil
+}
+
+// LoadUCITrack reads a ucitrack config file, e.g. /etc/config/ucitrack.
+func LoadUCITrack(filename string) (*UCITrack, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("reading ucitrack failed: %w", err)
+	}
+	defer f.Close()
+	return ParseUCITrack(f)
+}
+
+func newUCITrack(cfg *config) *UCITrack {
+	u := &UCITrack{
+		inits:   make(map[string][]string),
+		affects: make(map[string][]string),
+	}
+	for _, sec := range cfg.Sections {
+		if opt := sec.Get("init"); opt != nil {
+			u.inits[sec.Type] = appendUnique(u.inits[sec.Type], opt.Values...)
+		}
+		if opt := sec.Get("affects"); opt != nil {
+			u.affects[sec.Type] = appendUnique(u.affects[sec.Type], opt.Values...)
+		}
+	}
+	return u
+}
+
+// Resolve computes the transitive closure of the given configs over
+// the "affects" relation. It returns all affected configs (including
+// the given ones), and the init scripts to reload for them. Both lists
+// are ordered by discovery and free of duplicates.
+func (u *UCITrack) Resolve(configs ...string) (affected, services []string) {
+	affected = appendUnique(nil, configs...)
+	for i := 0; i < len(affected); i++ {
+		name := affected[i]
+		services = appendUnique(services, u.inits[name]...)
+		affected = appendUnique(affected, u.affects[name]...)
+	}
+	return affected, services
+}
+
+func appendUnique(list []string, values ...string) []string {
+outer:
+	for _, v := range values {
+		for _, have := range list {
+			if have == v {
+				continue outer
+			}
+		}
+		list = append(list, v)
+	}
+	return list
+}
+
+// A CommandRunner executes an external command.
+type CommandRunner func(name string, args ...string) error
+
+// ExecRunner is a CommandRunner using os/exec. The command's output is
+// included in the returned error, if the command fails.
+func ExecRunner(name string, args ...string) error {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		cmd := strings.Join(append([]string{name}, args...), " ")
+		return fmt.Errorf("%s: %w: %s", cmd, err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// ReloadHook returns a post-commit hook, which reloads the init scripts
+// affected by the committed configs (by running "/etc/init.d/$svc reload"
+// through run). If run is nil, ExecRunner is used.
+//
+// All services are reloaded, even if some fail; the errors are joined.
+func ReloadHook(track *UCITrack, run CommandRunner) CommitHook {
+	if run == nil {
+		run = ExecRunner
+	}
+	return func(configs []string) error {
+		_, services := track.Resolve(configs...)
+
+		var errs []error
+		for _, svc := range services {
+			if err := run(filepath.Join(InitScriptDir, svc), "reload"); err != nil {
+				errs = append(errs, fmt.Errorf("reloading %s failed: %w", svc, err))
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
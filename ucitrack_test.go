@@ -0,0 +1,92 @@
+package uci
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUCITrackResolve(t *testing.T) {
+	track, err := LoadUCITrack(filepath.Join("testdata", "ucitrack"))
+	require.NoError(t, err)
+
+	tt := map[string]struct {
+		configs  []string
+		affected []string
+		services []string
+	}{
+		"none":    {},
+		"unknown": {[]string{"foo"}, []string{"foo"}, nil},
+		"leaf":    {[]string{"dropbear"}, []string{"dropbear"}, []string{"dropbear"}},
+		"transitive": {
+			configs:  []string{"wireless"},
+			affected: []string{"wireless", "network", "dhcp", "radvd", "odhcpd"},
+			services: []string{"network", "dnsmasq", "odhcpd"},
+		},
+		"overlapping": {
+			configs:  []string{"system", "dhcp"},
+			affected: []string{"system", "dhcp", "luci_statistics", "odhcpd"},
+			services: []string{"led", "dnsmasq", "odhcpd"},
+		},
+	}
+
+	for name, tc := range tt {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			affected, services := track.Resolve(tc.configs...)
+			assert.Equal(t, tc.affected, affected)
+			assert.Equal(t, tc.services, services)
+		})
+	}
+}
+
+func TestUCITrackMergeSections(t *testing.T) {
+	track, err := ParseUCITrack(strings.NewReader(`
+config firewall
+	option init firewall
+
+config firewall
+	option init fw_helper
+	list affects qos
+`))
+	require.NoError(t, err)
+
+	affected, services := track.Resolve("firewall")
+	assert.Equal(t, []string{"firewall", "qos"}, affected)
+	assert.Equal(t, []string{"firewall", "fw_helper"}, services)
+}
+
+func TestParseUCITrack_invalid(t *testing.T) {
+	_, err := ParseUCITrack(strings.NewReader("config 'foo"))
+	assert.Error(t, err)
+
+	_, err = LoadUCITrack(filepath.Join("testdata", "nonexistent"))
+	assert.Error(t, err)
+}
+
+func TestReloadHook(t *testing.T) {
+	assert := assert.New(t)
+	track, err := LoadUCITrack(filepath.Join("testdata", "ucitrack"))
+	require.NoError(t, err)
+
+	var calls []string
+	run := func(name string, args ...string) error {
+		calls = append(calls, strings.Join(append([]string{name}, args...), " "))
+		if strings.HasSuffix(name, "dnsmasq") {
+			return errors.New("exit status 1") //nolint:goerr113
+		}
+		return nil
+	}
+
+	err = ReloadHook(track, run)([]string{"network"})
+	assert.EqualError(err, "reloading dnsmasq failed: exit status 1")
+	assert.Equal([]string{
+		"/etc/init.d/network reload",
+		"/etc/init.d/dnsmasq reload",
+		"/etc/init.d/odhcpd reload",
+	}, calls)
+}
@@ -0,0 +1,70 @@
+package uci
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func numberedLines(from, to int) string {
+	var buf strings.Builder
+	for i := from; i <= to; i++ {
+		fmt.Fprintf(&buf, "line %d\n", i)
+	}
+	return buf.String()
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	tt := map[string]struct {
+		a, b     string
+		expected string
+	}{
+		"equal": {
+			a: "foo\nbar\n",
+			b: "foo\nbar\n",
+		},
+		"created": {
+			a:        "",
+			b:        "foo\nbar\n",
+			expected: "--- a\n+++ b\n@@ -0,0 +1,2 @@\n+foo\n+bar\n",
+		},
+		"deleted": {
+			a:        "foo\n",
+			b:        "",
+			expected: "--- a\n+++ b\n@@ -1 +0,0 @@\n-foo\n",
+		},
+		"no newline": {
+			a:        "foo\nbar",
+			b:        "foo\nbar\n",
+			expected: "--- a\n+++ b\n@@ -1,2 +1,2 @@\n foo\n-bar\n\\ No newline at end of file\n+bar\n",
+		},
+		"context": {
+			a: numberedLines(1, 10),
+			b: strings.Replace(numberedLines(1, 10), "line 5\n", "line five\n", 1),
+			expected: "--- a\n+++ b\n@@ -2,7 +2,7 @@\n" +
+				" line 2\n line 3\n line 4\n-line 5\n+line five\n line 6\n line 7\n line 8\n",
+		},
+		"separate hunks": {
+			a: numberedLines(1, 20),
+			b: strings.Replace(strings.Replace(numberedLines(1, 20), "line 2\n", "", 1), "line 19\n", "line 19\nline 19a\n", 1),
+			expected: "--- a\n+++ b\n" +
+				"@@ -1,5 +1,4 @@\n line 1\n-line 2\n line 3\n line 4\n line 5\n" +
+				"@@ -17,4 +16,5 @@\n line 17\n line 18\n line 19\n+line 19a\n line 20\n",
+		},
+		"merged hunks": {
+			a: numberedLines(1, 10),
+			b: strings.Replace(strings.Replace(numberedLines(1, 10), "line 2\n", "", 1), "line 8\n", "", 1),
+			expected: "--- a\n+++ b\n" +
+				"@@ -1,10 +1,8 @@\n line 1\n-line 2\n line 3\n line 4\n line 5\n line 6\n line 7\n-line 8\n line 9\n line 10\n",
+		},
+	}
+
+	for name, tc := range tt {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, unifiedDiff("a", "b", tc.a, tc.b))
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package uci
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ConfigView provides read-only access to a single config. Unnamed
+// sections are addressed by their synthetic name (e.g. "@rule[2]").
+type ConfigView interface {
+	// Name returns the name of the config.
+	Name() string
+
+	// Sections returns the names of all sections, in order.
+	Sections() []string
+
+	// SectionType returns the type of a section, and whether it exists.
+	SectionType(section string) (string, bool)
+
+	// Options returns the names of all options of a section, in order.
+	Options(section string) []string
+
+	// Get returns the values of an option, and whether it exists.
+	Get(section, option string) ([]string, bool)
+}
+
+type configView struct{ cfg *config }
+
+var _ ConfigView = configView{}
+
+func (v configView) Name() string {
+	return v.cfg.Name
+}
+
+func (v configView) Sections() []string {
+	names := make([]string, 0, len(v.cfg.Sections))
+	for _, sec := range v.cfg.Sections {
+		names = append(names, v.cfg.sectionName(sec))
+	}
+	return names
+}
+
+func (v configView) SectionType(section string) (string, bool) {
+	if sec := v.cfg.Get(section); sec != nil {
+		return sec.Type, true
+	}
+	return "", false
+}
+
+func (v configView) Options(section string) []string {
+	sec := v.cfg.Get(section)
+	if sec == nil {
+		return nil
+	}
+	names := make([]string, 0, len(sec.Options))
+	for _, opt := range sec.Options {
+		names = append(names, opt.Name)
+	}
+	return names
+}
+
+func (v configView) Get(section, option string) ([]string, bool) {
+	sec := v.cfg.Get(section)
+	if sec == nil {
+		return nil, false
+	}
+	opt := sec.Get(option)
+	if opt == nil {
+		return nil, false
+	}
+	return append([]string(nil), opt.Values...), true
+}
+
+// A Validator checks a config before Commit writes it to disk. Returning
+// an error vetoes the commit; validators should return a ValidationError
+// listing the offending sections and options.
+//
+// Validators are called while the tree is locked, and hence must not
+// call any Tree methods.
+type Validator func(cfg ConfigView) error
+
+// A ValidatorRegistrar validates configs before committing them. Trees
+// created by NewTree implement it, and so do their wrappers (see ReadOnly
+// and Fork), if the wrapped tree does.
+type ValidatorRegistrar interface {
+	// AddValidator registers a validator for a config, or for all configs
+	// if config is empty. Commit calls the validators for all configs to
+	// write, and writes nothing if any of them fails.
+	AddValidator(config string, v Validator)
+}
+
+var _ ValidatorRegistrar = (*tree)(nil)
+
+// Problem describes a single validation failure. Option is empty, if the
+// problem concerns the whole section, and Section is empty, if it
+// concerns the whole config.
+type Problem struct {
+	Section string
+	Option  string
+	Message string
+}
+
+func (p Problem) String() string {
+	switch {
+	case p.Section == "":
+		return p.Message
+	case p.Option == "":
+		return fmt.Sprintf("%s: %s", p.Section, p.Message)
+	}
+	return fmt.Sprintf("%s.%s: %s", p.Section, p.Option, p.Message)
+}
+
+// ValidationError is returned by Validators (and in turn by Commit), if
+// a config is invalid.
+type ValidationError struct {
+	Config   string
+	Problems []Problem
+}
+
+func (err ValidationError) Error() string {
+	msgs := make([]string, 0, len(err.Problems))
+	for _, p := range err.Problems {
+		msgs = append(msgs, p.String())
+	}
+	return fmt.Sprintf("validation of %s failed: %s", err.Config, strings.Join(msgs, "; "))
+}
+
+// Add records a problem for a section or option.
+func (err *ValidationError) Add(section, option, format string, args ...interface{}) {
+	err.Problems = append(err.Problems, Problem{
+		Section: section,
+		Option:  option,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// Err returns err, if any problems were recorded, and nil otherwise.
+// This simplifies writing validators.
+func (err *ValidationError) Err() error {
+	if len(err.Problems) == 0 {
+		return nil
+	}
+	return *err
+}
+
+func (t *tree) AddValidator(config string, v Validator) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.validators == nil {
+		t.validators = make(map[string][]Validator)
+	}
+	t.validators[config] = append(t.validators[config], v)
+}
+
+// validate checks the given configs against the schema, and runs the
+// global validators and those registered for these configs. Its call
+// must be guarded by locking the tree's mutex and the configs (at least
+// for reading).
+func (t *tree) validate(configs []*config) error {
+	var errs []error
+	for _, cfg := range configs {
+		if err := t.schema.validate(cfg); err != nil {
+			errs = append(errs, err)
+		}
+		view := configView{cfg}
+		for _, key := range []string{"", cfg.Name} {
+			for _, v := range t.validators[key] {
+				if err := v(view); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,120 @@
+package uci
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func validateIPAddr(cfg ConfigView) error {
+	verr := ValidationError{Config: cfg.Name()}
+	for _, sec := range cfg.Sections() {
+		if typ, _ := cfg.SectionType(sec); typ != "interface" {
+			continue
+		}
+		values, ok := cfg.Get(sec, "ipaddr")
+		if !ok {
+			continue
+		}
+		for _, v := range values {
+			if net.ParseIP(v) == nil {
+				verr.Add(sec, "ipaddr", "invalid IP address %q", v)
+			}
+		}
+	}
+	return verr.Err()
+}
+
+func TestValidator(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	r := NewTree(dir)
+
+	var seen []string
+	r.(ValidatorRegistrar).AddValidator("", func(cfg ConfigView) error {
+		seen = append(seen, cfg.Name())
+		return nil
+	})
+	r.(ValidatorRegistrar).AddValidator("network", validateIPAddr)
+
+	require.NoError(t, r.AddSection("network", "lan", "interface"))
+	require.NoError(t, r.SetType("network", "lan", "ipaddr", TypeOption, "192.168.1.300"))
+	require.NoError(t, r.AddSection("system", "main", "system"))
+
+	err := r.Commit()
+	assert.Equal([]string{"network", "system"}, seen)
+	var verr ValidationError
+	require.ErrorAs(t, err, &verr)
+	assert.Equal("network", verr.Config)
+	assert.Equal([]Problem{{
+		Section: "lan",
+		Option:  "ipaddr",
+		Message: `invalid IP address "192.168.1.300"`,
+	}}, verr.Problems)
+	assert.EqualError(err, `validation of network failed: lan.ipaddr: invalid IP address "192.168.1.300"`)
+
+	// nothing written
+	assert.NoFileExists(filepath.Join(dir, "system"))
+	assert.NoFileExists(filepath.Join(dir, "network"))
+
+	// only validators for committed configs are run
+	seen = nil
+	assert.NoError(r.Commit("system"))
+	assert.Equal([]string{"system"}, seen)
+
+	require.NoError(t, r.SetType("network", "lan", "ipaddr", TypeOption, "192.168.1.1"))
+	assert.NoError(r.Commit())
+}
+
+func TestValidatorRegistrar(t *testing.T) {
+	assert := assert.New(t)
+	r := NewTree(t.TempDir())
+
+	assert.Implements((*ValidatorRegistrar)(nil), r)
+	assert.Implements((*ValidatorRegistrar)(nil), ReadOnly(r))
+	assert.Implements((*ValidatorRegistrar)(nil), r.(Cloner).Clone())
+
+	// forks of trees without validator support
+	f := &Fork{Tree: struct{ Tree }{r}}
+	f.AddValidator("", func(ConfigView) error { return nil }) // no-op
+}
+
+func TestConfigView(t *testing.T) {
+	assert := assert.New(t)
+	cfg, err := parse("unnamed", tcUnnamedInput)
+	require.NoError(t, err)
+	view := configView{cfg}
+
+	assert.Equal("unnamed", view.Name())
+	assert.Equal([]string{"named", "@foo[1]", "@foo[2]"}, view.Sections())
+
+	typ, ok := view.SectionType("@foo[1]")
+	assert.True(ok)
+	assert.Equal("foo", typ)
+	_, ok = view.SectionType("nonexistent")
+	assert.False(ok)
+
+	assert.Equal([]string{"pos", "unnamed", "list"}, view.Options("named"))
+	assert.Nil(view.Options("nonexistent"))
+
+	values, ok := view.Get("named", "list")
+	assert.True(ok)
+	assert.Equal([]string{"0", "30"}, values)
+	_, ok = view.Get("named", "nonexistent")
+	assert.False(ok)
+	_, ok = view.Get("nonexistent", "list")
+	assert.False(ok)
+}
+
+func TestProblemString(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("missing", Problem{Message: "missing"}.String())
+	assert.Equal("lan: missing", Problem{Section: "lan", Message: "missing"}.String())
+	assert.Equal("lan.proto: missing", Problem{Section: "lan", Option: "proto", Message: "missing"}.String())
+
+	verr := &ValidationError{Config: "network"}
+	assert.NoError(verr.Err())
+}
@@ -0,0 +1,111 @@
+package uci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrWatchNotSupported is returned by Watcher.Watch on platforms without
+// inotify support, and for trees not implementing Watcher.
+var ErrWatchNotSupported = errors.New("watching config files is not supported on this platform")
+
+// Watcher is implemented by trees, which can monitor their directory
+// (e.g. those created by NewTree).
+type Watcher interface {
+	// Watch monitors the tree's directory for modified config files
+	// (using inotify, on Linux only). Changed configs are reloaded, if
+	// they are already loaded and have no pending changes, and a
+	// WatchEvent describing the differences is delivered over the
+	// returned channel.
+	//
+	// Watching stops and the channel is closed when ctx is canceled. The
+	// caller must drain the channel, otherwise the watcher blocks.
+	Watch(ctx context.Context) (<-chan WatchEvent, error)
+}
+
+var _ Watcher = (*tree)(nil)
+
+// watchTree calls t.Watch, if t implements Watcher.
+func watchTree(ctx context.Context, t Tree) (<-chan WatchEvent, error) {
+	if w, ok := t.(Watcher); ok {
+		return w.Watch(ctx)
+	}
+	return nil, ErrWatchNotSupported
+}
+
+// WatchEvent is delivered by Watcher.Watch whenever a loaded config was
+// changed on disk and has been reloaded.
+type WatchEvent struct {
+	// Config is the name of the config file.
+	Config string
+
+	// Changes lists the differences between the previously loaded
+	// version and the reloaded version. A deleted file is reported as
+	// the removal of all its sections.
+	Changes []Change
+
+	// Err is set, if the changed file could not be reloaded (e.g. it
+	// contained a syntax error). The previously loaded version is kept
+	// in this case.
+	Err error
+}
+
+// reloadChanged reloads a config after it has been modified on disk. It
+// returns false, if no event needs to be delivered, which is the case if
+// the config was not loaded, has pending changes, or its content did not
+// change.
+func (t *tree) reloadChanged(name string) (WatchEvent, bool) {
+	t.mu.RLock()
+	old, ok := t.configs[name]
+	var tainted bool
+	var gen uint64
+	if ok {
+		old.mu.RLock()
+		tainted, gen = old.tainted, old.gen
+		old.mu.RUnlock()
+	}
+	t.mu.RUnlock()
+	if !ok || tainted {
+		return WatchEvent{}, false
+	}
+
+	// read the file without holding any lock
+	cfg, err := t.readConfig(name)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return WatchEvent{Config: name, Err: fmt.Errorf("reload: %w", err)}, true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// skip, if the config was modified, reloaded or reverted meanwhile
+	if t.configs[name] != old || old.tainted || old.gen != gen {
+		return WatchEvent{}, false
+	}
+	if err != nil {
+		delete(t.configs, name)
+		cfg = newConfig(name)
+	} else {
+		t.configs[name] = cfg
+	}
+
+	changes := diffConfigs(old, cfg)
+	if len(changes) == 0 {
+		return WatchEvent{}, false
+	}
+	return WatchEvent{Config: name, Changes: changes}, true
+}
+
+// loadedConfigs returns the names of all configs currently held in memory.
+func (t *tree) loadedConfigs() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	names := make([]string, 0, len(t.configs))
+	for name := range t.configs {
+		names = append(names, name)
+	}
+	return names
+}
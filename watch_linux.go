@@ -0,0 +1,107 @@
+//go:build linux
+
+package uci
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO |
+	syscall.IN_MOVED_FROM | syscall.IN_DELETE
+
+func (t *tree) Watch(ctx context.Context) (<-chan WatchEvent, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("watch: inotify_init1: %w", err)
+	}
+	if _, err = syscall.InotifyAddWatch(fd, t.dir, inotifyMask); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("watch: inotify_add_watch: %w", err)
+	}
+
+	// Since fd is non-blocking, os.NewFile registers it with the runtime
+	// poller. This allows us to interrupt a pending Read by closing f.
+	f := os.NewFile(uintptr(fd), "inotify")
+	go func() {
+		<-ctx.Done()
+		f.Close()
+	}()
+
+	events := make(chan WatchEvent)
+	go t.watchLoop(ctx, f, events)
+	return events, nil
+}
+
+func (t *tree) watchLoop(ctx context.Context, f *os.File, events chan<- WatchEvent) {
+	defer close(events)
+
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := f.Read(buf)
+		if err != nil {
+			if ctx.Err() == nil {
+				t.sendEvent(ctx, events, WatchEvent{Err: fmt.Errorf("watch: read: %w", err)})
+			}
+			return
+		}
+
+		names, overflow, done := parseInotifyEvents(buf[:n])
+		if overflow {
+			names = t.loadedConfigs()
+		}
+		for _, name := range names {
+			if ev, ok := t.reloadChanged(name); ok && !t.sendEvent(ctx, events, ev) {
+				return
+			}
+		}
+		if done {
+			return
+		}
+	}
+}
+
+func (t *tree) sendEvent(ctx context.Context, events chan<- WatchEvent, ev WatchEvent) bool {
+	select {
+	case events <- ev:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// parseInotifyEvents extracts the (deduplicated) file names from a
+// buffer filled by read(2) on an inotify descriptor. Dotfiles (such as
+// the temporary files created by Commit) are ignored. It also reports
+// whether the kernel's event queue overflowed, and whether the watch
+// was removed (e.g. because the directory was deleted).
+func parseInotifyEvents(buf []byte) (names []string, overflow, done bool) {
+	seen := make(map[string]bool)
+	for off := 0; off+syscall.SizeofInotifyEvent <= len(buf); {
+		raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off])) //nolint:gosec
+		start := off + syscall.SizeofInotifyEvent
+		off = start + int(raw.Len)
+
+		switch {
+		case raw.Mask&syscall.IN_Q_OVERFLOW != 0:
+			overflow = true
+			continue
+		case raw.Mask&syscall.IN_IGNORED != 0:
+			done = true
+			continue
+		}
+
+		name := string(bytes.TrimRight(buf[start:off], "\x00"))
+		if name == "" || strings.HasPrefix(name, ".") || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names, overflow, done
+}
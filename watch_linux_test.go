@@ -0,0 +1,65 @@
+//go:build linux
+
+package uci
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatch(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "test", "config foo 'bar'\n\toption baz '1'\n")
+	writeTestConfig(t, dir, "other", "config foo 'bar'\n")
+
+	r := NewTree(dir)
+	require.NoError(t, r.LoadConfig("test", false))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := r.(Watcher).Watch(ctx)
+	require.NoError(t, err)
+
+	// not loaded, hence ignored
+	writeTestConfig(t, dir, "other", "config foo 'baz'\n")
+
+	// simulate an atomic update, like Commit() does
+	tmp := filepath.Join(dir, ".tmp.test")
+	writeTestConfig(t, dir, ".tmp.test", "config foo 'bar'\n\toption baz '2'\n")
+	require.NoError(t, os.Rename(tmp, filepath.Join(dir, "test")))
+
+	select {
+	case ev := <-events:
+		assert.Equal("test", ev.Config)
+		assert.NoError(ev.Err)
+		assert.Equal([]Change{
+			{Type: OptionSet, Section: "bar", SectionType: "foo", Option: "baz", Values: []string{"2"}},
+		}, ev.Changes)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for watch event")
+	}
+
+	value, _ := r.GetLast("test", "bar", "baz")
+	assert.Equal("2", value)
+
+	cancel()
+	select {
+	case _, ok := <-events:
+		assert.False(ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for watcher to stop")
+	}
+}
+
+func TestWatch_nonExistent(t *testing.T) {
+	r := NewTree(filepath.Join(t.TempDir(), "nonexistent"))
+	_, err := r.(Watcher).Watch(context.Background())
+	assert.Error(t, err)
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package uci
+
+import "context"
+
+func (t *tree) Watch(context.Context) (<-chan WatchEvent, error) {
+	return nil, ErrWatchNotSupported
+}
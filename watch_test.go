@@ -0,0 +1,86 @@
+package uci
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestConfig(t *testing.T, dir, name, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+}
+
+func TestReloadChanged(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "test", "config foo 'bar'\n\toption baz '1'\n")
+
+	r := NewTree(dir).(*tree)
+
+	// not loaded yet
+	_, ok := r.reloadChanged("test")
+	assert.False(ok)
+
+	assert.NoError(r.LoadConfig("test", false))
+
+	// unchanged
+	_, ok = r.reloadChanged("test")
+	assert.False(ok)
+
+	writeTestConfig(t, dir, "test", "config foo 'bar'\n\toption baz '2'\n")
+	ev, ok := r.reloadChanged("test")
+	assert.True(ok)
+	assert.Equal("test", ev.Config)
+	assert.NoError(ev.Err)
+	assert.Equal([]Change{
+		{Type: OptionSet, Section: "bar", SectionType: "foo", Option: "baz", Values: []string{"2"}},
+	}, ev.Changes)
+
+	values, _ := r.Get("test", "bar", "baz")
+	assert.Equal([]string{"2"}, values)
+
+	// parse errors keep the old version
+	writeTestConfig(t, dir, "test", "config foo 'bar\n")
+	ev, ok = r.reloadChanged("test")
+	assert.True(ok)
+	assert.Error(ev.Err)
+	values, _ = r.Get("test", "bar", "baz")
+	assert.Equal([]string{"2"}, values)
+
+	// pending changes are not overwritten
+	writeTestConfig(t, dir, "test", "config foo 'bar'\n\toption baz '3'\n")
+	assert.NoError(r.SetType("test", "bar", "baz", TypeOption, "4"))
+	_, ok = r.reloadChanged("test")
+	assert.False(ok)
+	values, _ = r.Get("test", "bar", "baz")
+	assert.Equal([]string{"4"}, values)
+
+	// deleted files
+	r.Revert()
+	assert.NoError(r.LoadConfig("test", false))
+	assert.NoError(os.Remove(filepath.Join(dir, "test")))
+	ev, ok = r.reloadChanged("test")
+	assert.True(ok)
+	assert.Equal([]Change{
+		{Type: SectionRemoved, Section: "bar", SectionType: "foo"},
+	}, ev.Changes)
+	assert.NotContains(r.configs, "test")
+}
+
+func TestWatcher(t *testing.T) {
+	assert := assert.New(t)
+	r := NewTree(t.TempDir())
+
+	assert.Implements((*Watcher)(nil), r)
+	assert.Implements((*Watcher)(nil), ReadOnly(r))
+	assert.Implements((*Watcher)(nil), r.(Cloner).Clone())
+
+	// trees without Watch method
+	_, err := watchTree(context.Background(), struct{ Tree }{r})
+	assert.ErrorIs(err, ErrWatchNotSupported)
+}